@@ -0,0 +1,164 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/dispatcher"
+)
+
+// adminAuth secures the admin API with a static bearer token when OAuth2 is disabled
+func adminAuth(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+	return func(ginCtx *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(ginCtx.Request.Header.Get("Authorization")), expected) != 1 {
+			glog.Warningf("rejected unauthenticated admin request from %s", ginCtx.ClientIP())
+			ginCtx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			ginCtx.Abort()
+			return
+		}
+		ginCtx.Next()
+	}
+}
+
+// adminErrorStatus is 409 if only the leader may do what was asked for, 503 if a queue is full
+// and the given status for all other errors
+func adminErrorStatus(err error, status int) int {
+	if err == dispatcher.ErrFollowing {
+		return http.StatusConflict
+	}
+	if _, full := err.(*dispatcher.QueueFullError); full {
+		return http.StatusServiceUnavailable
+	}
+	return status
+}
+
+// replayEvents pushes a JSONL capture of Marathon events through the dispatcher
+func replayEvents(ginCtx *gin.Context) {
+	defer ginCtx.Request.Body.Close()
+	rate, err := strconv.Atoi(ginCtx.DefaultQuery("rate", "0"))
+	if err != nil || rate < 0 || rate > dispatcher.MaxReplayRate {
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rate must be a number of events per second between 0 and %d", dispatcher.MaxReplayRate)})
+		return
+	}
+	result, err := dispatcher.Replay(ginCtx.Request.Body, ginCtx.Query("backend"), rate)
+	if err != nil {
+		ginCtx.JSON(adminErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error(), "result": result})
+		return
+	}
+	ginCtx.JSON(http.StatusOK, result)
+}
+
+// listDeadLetters returns the dead letters of a backend
+func listDeadLetters(ginCtx *gin.Context) {
+	ginCtx.JSON(http.StatusOK, dispatcher.DeadLetters(ginCtx.Param("backend")))
+}
+
+// deadLetterID parses the dead letter id of the route, responding with 404 if there is no such dead letter
+func deadLetterID(ginCtx *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(ginCtx.Param("id"), 10, 64)
+	if err == nil {
+		if _, ok := dispatcher.DeadLetter(ginCtx.Param("backend"), id); ok {
+			return id, true
+		}
+	}
+	ginCtx.JSON(http.StatusNotFound, gin.H{"error": "no such dead letter"})
+	return 0, false
+}
+
+// getDeadLetter returns a dead letter with its payload and the errors of all attempts
+func getDeadLetter(ginCtx *gin.Context) {
+	id, ok := deadLetterID(ginCtx)
+	if !ok {
+		return
+	}
+	entry, _ := dispatcher.DeadLetter(ginCtx.Param("backend"), id)
+	ginCtx.JSON(http.StatusOK, entry)
+}
+
+// redriveDeadLetter dispatches a dead letter to its backend again
+func redriveDeadLetter(ginCtx *gin.Context) {
+	id, ok := deadLetterID(ginCtx)
+	if !ok {
+		return
+	}
+	if err := dispatcher.Redrive(ginCtx.Param("backend"), id); err != nil {
+		ginCtx.JSON(adminErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	ginCtx.JSON(http.StatusAccepted, gin.H{"redriven": id})
+}
+
+// discardDeadLetter removes a dead letter without handling it
+func discardDeadLetter(ginCtx *gin.Context) {
+	id, ok := deadLetterID(ginCtx)
+	if !ok {
+		return
+	}
+	if err := dispatcher.Discard(ginCtx.Param("backend"), id); err != nil {
+		ginCtx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ginCtx.JSON(http.StatusOK, gin.H{"discarded": id})
+}
+
+// reconcileBackends lets the backend given by ?backend=, or all backends, reconcile their resources now
+func reconcileBackends(ginCtx *gin.Context) {
+	results, err := dispatcher.Reconcile(ginCtx.Query("backend"))
+	if err != nil {
+		ginCtx.JSON(adminErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+	ginCtx.JSON(http.StatusOK, results)
+}
+
+// lastReconciliation returns the result of the last reconciliation of every backend
+func lastReconciliation(ginCtx *gin.Context) {
+	ginCtx.JSON(http.StatusOK, dispatcher.LastReconciliation())
+}
+
+// reloadConfig reads the configuration again and applies it to the running backends
+func reloadConfig(ginCtx *gin.Context) {
+	if err := dispatcher.ReloadConfig(); err != nil {
+		glog.Errorf("unable to reload configuration: %s", err)
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ginCtx.JSON(http.StatusOK, gin.H{"reloaded": true})
+}
+
+// listBackends returns the registered backends with their state and queue
+func listBackends(ginCtx *gin.Context) {
+	ginCtx.JSON(http.StatusOK, dispatcher.Backends())
+}
+
+// setBackendState pauses, resumes or disables the backend of the route
+func setBackendState(state string) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		name := ginCtx.Param("backend")
+		if err := dispatcher.SetBackendState(name, state); err != nil {
+			glog.Errorf("unable to change state of backend '%s': %s", name, err)
+			status := http.StatusInternalServerError
+			if !registered(name) {
+				status = http.StatusNotFound
+			}
+			ginCtx.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		ginCtx.JSON(http.StatusOK, gin.H{"backend": name, "state": state})
+	}
+}
+
+// registered reports whether a backend with the given name is registered
+func registered(name string) bool {
+	for _, info := range dispatcher.Backends() {
+		if info.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/dispatcher"
+)
+
+// statuses of an event of a batch
+const (
+	eventAccepted = "accepted"
+	eventInvalid  = "invalid"
+	eventFailed   = "failed"
+)
+
+// eventResult describes the outcome of a single event of a batch
+type eventResult struct {
+	Index      int                    `json:"index"`
+	Status     string                 `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+	Violations []dispatcher.Violation `json:"violations,omitempty"`
+	Backends   []dispatcher.Outcome   `json:"backends,omitempty"`
+	err        error
+}
+
+// ingest tags a raw Marathon event with the cluster, validates and dispatches it. With a positive wait,
+// it waits that long for the backends to handle the event and reports their outcomes.
+func ingest(payload []byte, cluster string, wait time.Duration) eventResult {
+	payload, err := dispatcher.Tag(payload, cluster)
+	if err != nil {
+		return eventResult{Status: eventInvalid, Error: err.Error(), err: err}
+	}
+	_, marathonEvent, err := dispatcher.Decode(payload)
+	if err != nil {
+		result := eventResult{Status: eventInvalid, Error: err.Error(), err: err}
+		if invalid, ok := err.(*dispatcher.ValidationError); ok {
+			result.Violations = invalid.Violations
+		}
+		return result
+	}
+	if wait > 0 {
+		outcomes, err := dispatcher.DispatchAndWait(payload, marathonEvent, wait)
+		if err != nil {
+			return eventResult{Status: eventFailed, Error: err.Error(), err: err}
+		}
+		return eventResult{Status: eventAccepted, Backends: outcomes}
+	}
+	if err := dispatcher.Dispatch(payload, marathonEvent); err != nil {
+		return eventResult{Status: eventFailed, Error: err.Error(), err: err}
+	}
+	return eventResult{Status: eventAccepted}
+}
+
+// splitBatch returns the events of a JSON array or of newline delimited JSON
+func splitBatch(body []byte) ([][]byte, error) {
+	body = bytes.TrimSpace(body)
+	var payloads [][]byte
+	if bytes.HasPrefix(body, []byte("[")) {
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, fmt.Errorf("unable to decode event array: %s", err)
+		}
+		for _, item := range items {
+			payloads = append(payloads, item)
+		}
+		return payloads, nil
+	}
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			payloads = append(payloads, line)
+		}
+	}
+	return payloads, nil
+}
+
+// endpoint for receiving a JSON array or newline delimited JSON of marathon events,
+// they are dispatched in order and answered with a result per event
+func createEvents(ginCtx *gin.Context) {
+	cluster, ok := clusterOf(ginCtx)
+	if !ok {
+		return
+	}
+	body, err := ioutil.ReadAll(ginCtx.Request.Body)
+	defer ginCtx.Request.Body.Close()
+	if err != nil {
+		glog.Errorf("unable to read request body: %s", err)
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	payloads, err := splitBatch(body)
+	if err != nil {
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]eventResult, len(payloads))
+	accepted := 0
+	for i, payload := range payloads {
+		results[i] = ingest(payload, cluster, 0)
+		results[i].Index = i
+		if results[i].Status == eventAccepted {
+			accepted++
+		} else {
+			glog.Warningf("event %d of batch from %s is %s: %s", i, ginCtx.ClientIP(), results[i].Status, results[i].Error)
+		}
+	}
+	ginCtx.JSON(http.StatusOK, gin.H{"accepted": accepted, "rejected": len(payloads) - accepted, "results": results})
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_splitBatch(t *testing.T) {
+	array := `[{"eventType": "app_terminated_event", "appId": "/a"}, {"eventType": "app_terminated_event", "appId": "/b"}]`
+	ndjson := "{\"eventType\": \"app_terminated_event\", \"appId\": \"/a\"}\n\n{\"eventType\": \"app_terminated_event\", \"appId\": \"/b\"}\n"
+	for _, body := range []string{array, ndjson} {
+		payloads, err := splitBatch([]byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payloads) != 2 || string(payloads[1]) != `{"eventType": "app_terminated_event", "appId": "/b"}` {
+			fmt.Printf("Expected 2 events, got: %q\n", payloads)
+			t.FailNow()
+		}
+	}
+	if _, err := splitBatch([]byte(`[{"eventType": "app_terminated_event"`)); err == nil {
+		fmt.Println("Truncated array is accepted")
+		t.FailNow()
+	}
+}
+
+func Test_ingest(t *testing.T) {
+	result := ingest([]byte(`{"eventType": "app_terminated_event"}`), "", 0)
+	if result.Status != eventInvalid || len(result.Violations) != 1 || result.Violations[0].Field != "appId" {
+		fmt.Printf("Expected appId violation, got: %+v\n", result)
+		t.FailNow()
+	}
+	if result := ingest([]byte(`{"eventType": "app_terminated_event", "appId": "/a"}`), "", 0); result.Status != eventAccepted {
+		fmt.Printf("Expected event to be accepted, got: %+v\n", result)
+		t.FailNow()
+	}
+	if result := ingest([]byte(`null`), "eu-west", 0); result.Status != eventInvalid {
+		fmt.Printf("Expected a null event to be invalid, got: %+v\n", result)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+// defaultSignatureHeader carries the HMAC of the body, if no other header is configured
+const defaultSignatureHeader = "X-Howler-Signature"
+
+// reasons an event callback is rejected for
+const (
+	rejectedIP        = "ip"
+	rejectedSignature = "signature"
+	rejectedToken     = "token"
+)
+
+var (
+	callbackRejectsMutex sync.Mutex
+	callbackRejects      = make(map[string]int64)
+)
+
+// rejectCallback counts and logs a rejected event callback and answers it
+func rejectCallback(ginCtx *gin.Context, reason string, status int, message string) {
+	callbackRejectsMutex.Lock()
+	callbackRejects[reason]++
+	callbackRejectsMutex.Unlock()
+	glog.Warningf("rejected event callback from %s to %s: %s", ginCtx.Request.RemoteAddr, ginCtx.Request.URL.Path, message)
+	ginCtx.JSON(status, gin.H{"error": message})
+	ginCtx.Abort()
+}
+
+// callbackAuth verifies the sender of events. The source address must be allowed, the body must carry
+// a valid signature and the token must match, as far as these checks are configured. The signature
+// may be left out if the token matches and the other way round, as Marathon can not sign its callbacks.
+func callbackAuth(settings conf.Callback) (gin.HandlerFunc, error) {
+	var allowed []*net.IPNet
+	for _, entry := range settings.AllowedIPs {
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed IP: %s", err)
+		}
+		allowed = append(allowed, network)
+	}
+	header := settings.Header
+	if header == "" {
+		header = defaultSignatureHeader
+	}
+	return func(ginCtx *gin.Context) {
+		if len(allowed) > 0 && !allowedIP(ginCtx.Request.RemoteAddr, allowed) {
+			rejectCallback(ginCtx, rejectedIP, http.StatusForbidden, "source address is not allowed")
+			return
+		}
+		if settings.Secret == "" && settings.Token == "" {
+			ginCtx.Next()
+			return
+		}
+		if settings.Token != "" && subtle.ConstantTimeCompare([]byte(ginCtx.Query("token")), []byte(settings.Token)) == 1 {
+			ginCtx.Next()
+			return
+		}
+		signature := ginCtx.Request.Header.Get(header)
+		if settings.Secret == "" || signature == "" {
+			rejectCallback(ginCtx, rejectedToken, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		body, err := ioutil.ReadAll(ginCtx.Request.Body)
+		ginCtx.Request.Body.Close()
+		if err != nil {
+			ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			ginCtx.Abort()
+			return
+		}
+		if !validSignature(settings.Secret, body, signature) {
+			rejectCallback(ginCtx, rejectedSignature, http.StatusUnauthorized, "invalid signature")
+			return
+		}
+		// the handlers read the body again
+		ginCtx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		ginCtx.Next()
+	}, nil
+}
+
+// allowedIP reports whether the address of the connection is in one of the networks. Forwarded-for headers
+// are ignored, as any sender can set them.
+func allowedIP(remoteAddr string, allowed []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validSignature reports whether the signature is the hex encoded HMAC-SHA256 of the body,
+// optionally prefixed with sha256=
+func validSignature(secret string, body []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	signature = strings.TrimPrefix(strings.ToLower(signature), "sha256=")
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+//CallbackAspect counts the rejected event callbacks by reason for the monitoring endpoint
+type CallbackAspect struct{}
+
+//GetStats returns the number of rejected event callbacks by reason
+func (a *CallbackAspect) GetStats() interface{} {
+	callbackRejectsMutex.Lock()
+	defer callbackRejectsMutex.Unlock()
+	stats := make(map[string]int64)
+	for reason, count := range callbackRejects {
+		stats[reason] = count
+	}
+	return stats
+}
+
+//Name returns the name of the aspect
+func (a *CallbackAspect) Name() string {
+	return "RejectedCallbacks"
+}
+
+//InRoot returns false, the stats are served at /RejectedCallbacks
+func (a *CallbackAspect) InRoot() bool {
+	return false
+}
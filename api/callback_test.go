@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+func Test_callbackAuth(t *testing.T) {
+	callbackRejectsMutex.Lock()
+	callbackRejects = make(map[string]int64)
+	callbackRejectsMutex.Unlock()
+	verify, err := callbackAuth(conf.Callback{Secret: "s3cret", Token: "t0ken", AllowedIPs: []string{"10.0.0.0/8", "192.168.1.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(verify)
+	router.POST("/events", func(ginCtx *gin.Context) {
+		body, _ := ioutil.ReadAll(ginCtx.Request.Body)
+		ginCtx.String(http.StatusOK, string(body))
+	})
+
+	body := []byte(`{"eventType": "app_terminated_event", "appId": "/a"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	post := func(remoteAddr, url, signature string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", url, bytes.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		if signature != "" {
+			req.Header.Set(defaultSignatureHeader, signature)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	if res := post("10.1.2.3:4567", "/events", signature); res.Code != http.StatusOK || res.Body.String() != string(body) {
+		fmt.Printf("Expected a signed event to pass with its body, got: %d %s\n", res.Code, res.Body.String())
+		t.FailNow()
+	}
+	if res := post("192.168.1.1:4567", "/events?token=t0ken", ""); res.Code != http.StatusOK {
+		fmt.Printf("Expected an event with the token to pass, got: %d\n", res.Code)
+		t.FailNow()
+	}
+	if res := post("192.168.1.2:4567", "/events?token=t0ken", signature); res.Code != http.StatusForbidden {
+		fmt.Printf("Expected an event from a foreign address to be forbidden, got: %d\n", res.Code)
+		t.FailNow()
+	}
+	if res := post("10.1.2.3:4567", "/events", "sha256=0000"); res.Code != http.StatusUnauthorized {
+		fmt.Printf("Expected an event with a wrong signature to be unauthorized, got: %d\n", res.Code)
+		t.FailNow()
+	}
+	if res := post("10.1.2.3:4567", "/events?token=wrong", ""); res.Code != http.StatusUnauthorized {
+		fmt.Printf("Expected an event with a wrong token to be unauthorized, got: %d\n", res.Code)
+		t.FailNow()
+	}
+	rejects := (&CallbackAspect{}).GetStats().(map[string]int64)
+	if rejects[rejectedIP] != 1 || rejects[rejectedSignature] != 1 || rejects[rejectedToken] != 1 {
+		fmt.Printf("Expected one rejection per reason, got: %v\n", rejects)
+		t.FailNow()
+	}
+
+	if _, err := callbackAuth(conf.Callback{AllowedIPs: []string{"10.0.0.0/33"}}); err == nil {
+		fmt.Println("Expected an invalid network to be refused")
+		t.FailNow()
+	}
+}
@@ -1,19 +1,16 @@
 package api
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
-	"github.com/kr/pretty"
-	"github.com/zalando-techmonkeys/howler/backend"
-	"github.com/zalando-techmonkeys/howler/backendconfig"
 	"github.com/zalando-techmonkeys/howler/conf"
+	"github.com/zalando-techmonkeys/howler/dispatcher"
+	"github.com/zalando-techmonkeys/howler/state"
 )
 
 // rootHandler serving "/" which returns build information
@@ -22,71 +19,127 @@ func rootHandler(ginCtx *gin.Context) {
 	ginCtx.JSON(http.StatusOK, gin.H{"howler": fmt.Sprintf("Version: %s - Build Time: %s - Git Commit Hash: %s", config.Version, config.BuildStamp, config.GitHash)})
 }
 
-// basic health check, will always return 'OK' for now
+// basic health check returning 'OK', with ?deep=true the backends are checked like with getHealth
 func getStatus(ginCtx *gin.Context) {
+	if ginCtx.Query("deep") == "true" {
+		getHealth(ginCtx)
+		return
+	}
 	ginCtx.String(http.StatusOK, "OK")
 }
 
-// endpoint for receiving marathon event bus messages
-// Plugins will get notified in a goroutine.
-func createEvent(ginCtx *gin.Context) {
+// getHealth checks the backends, answering 503 if a critical backend is down
+func getHealth(ginCtx *gin.Context) {
+	backends, healthy := dispatcher.CheckHealth()
+	status := http.StatusOK
+	if !healthy {
+		status = http.StatusServiceUnavailable
+	}
+	ginCtx.JSON(status, gin.H{"healthy": healthy, "backends": backends})
+}
 
-	eventType := determineEventType(ginCtx.Request)
+// default and upper bound of the time to wait for the backends with wait=true
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 5 * time.Minute
+)
 
-	// dispatching event types here
+// getState returns the apps, tasks and deployments of the cluster, the tasks of a single app with ?appId=
+func getState(ginCtx *gin.Context) {
+	if appID := ginCtx.Query("appId"); appID != "" {
+		app, ok := state.Cluster.App(appID)
+		if !ok {
+			ginCtx.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("app %s is unknown", appID)})
+			return
+		}
+		ginCtx.JSON(http.StatusOK, gin.H{"app": app, "tasks": state.Cluster.Tasks(appID)})
+		return
+	}
+	ginCtx.JSON(http.StatusOK, state.Cluster.Snapshot())
+}
 
-	switch eventType {
-	case "api_post_event":
-		var marathonEvent backend.APIRequestEvent
-		ginCtx.Bind(&marathonEvent)
+// clusterOf returns the cluster of the events posted to /clusters/:cluster/events, empty for /events.
+// Unknown clusters are answered with 404.
+func clusterOf(ginCtx *gin.Context) (string, bool) {
+	cluster := ginCtx.Params.ByName("cluster")
+	if cluster == "" {
+		return "", true
+	}
+	var known bool
+	if config.Configuration != nil {
+		_, known = config.Configuration.Clusters[cluster]
+	}
+	if !known {
+		ginCtx.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("cluster '%s' is not configured", cluster)})
+		return "", false
+	}
+	return cluster, true
+}
 
-		glog.Infof("dispatching to backends: %# v", pretty.Formatter(marathonEvent))
-		for _, backendImplementation := range backendconfig.RegisteredBackends {
-			glog.Infof("dispatching event to backend '%s'", backendImplementation.Name())
-			go backendImplementation.HandleCreate(marathonEvent)
+// endpoint for receiving marathon event bus messages, tagged with the cluster if posted to /clusters/:cluster/events.
+// Plugins will get notified in a goroutine. With wait=true, the response is delayed
+// until all backends handled the event or the timeout passed, and reports their outcomes.
+func createEvent(ginCtx *gin.Context) {
+	var wait time.Duration
+	if ginCtx.Query("wait") == "true" {
+		var err error
+		wait, err = time.ParseDuration(ginCtx.DefaultQuery("timeout", defaultWaitTimeout.String()))
+		if err != nil || wait <= 0 || wait > maxWaitTimeout {
+			ginCtx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("timeout must be a duration up to %s, p.e. 10s", maxWaitTimeout)})
+			return
 		}
-	case "status_update_event":
-		var marathonEvent backend.StatusUpdateEvent
-		ginCtx.Bind(&marathonEvent)
+	}
+	cluster, ok := clusterOf(ginCtx)
+	if !ok {
+		return
+	}
+	payload, err := ioutil.ReadAll(ginCtx.Request.Body)
+	defer ginCtx.Request.Body.Close()
+	if err != nil {
+		glog.Errorf("unable to read request body: %s", err)
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		glog.Infof("dispatching to backends: %# v", pretty.Formatter(marathonEvent))
-		for _, backendImplementation := range backendconfig.RegisteredBackends {
-			glog.Infof("dispatching event to backend '%s'", backendImplementation.Name())
-			go backendImplementation.HandleUpdate(marathonEvent)
+	// dispatching event types here
+	result := ingest(payload, cluster, wait)
+	switch result.Status {
+	case eventInvalid:
+		glog.Warningf("rejected event from %s: %s", ginCtx.ClientIP(), result.Error)
+		if invalid, ok := result.err.(*dispatcher.ValidationError); ok {
+			ginCtx.JSON(http.StatusBadRequest, gin.H{"error": result.Error, "eventType": invalid.EventType, "violations": invalid.Violations})
+			return
 		}
-	case "app_terminated_event":
-		var marathonEvent backend.AppTerminatedEvent
-		ginCtx.Bind(&marathonEvent)
-
-		glog.Infof("dispatching to backends: %# v", pretty.Formatter(marathonEvent))
-		for _, backendImplementation := range backendconfig.RegisteredBackends {
-			glog.Infof("dispatching event to backend '%s'", backendImplementation.Name())
-			go backendImplementation.HandleDestroy(marathonEvent)
+		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": result.Error})
+	case eventFailed:
+		glog.Error(result.Error)
+		status := http.StatusInternalServerError
+		if _, ok := result.err.(*dispatcher.QueueFullError); ok || result.err == dispatcher.ErrShuttingDown {
+			status = http.StatusServiceUnavailable
+		}
+		ginCtx.JSON(status, gin.H{"error": result.Error})
+	case eventAccepted:
+		if wait > 0 {
+			ginCtx.JSON(waitStatus(result.Backends), gin.H{"backends": result.Backends})
 		}
-	default:
-		msg := fmt.Sprintf("event type '%s' is not dispatched to any backend", eventType)
-		glog.Errorf(msg)
-		ginCtx.JSON(http.StatusBadRequest, gin.H{"error": msg})
-		return
 	}
 }
 
-func determineEventType(r *http.Request) string {
-
-	// temporary buffer
-	b := bytes.NewBuffer(make([]byte, 0))
-
-	// TeeReader returns a Reader that writes to b what it reads from r.Body.
-	reader := io.TeeReader(r.Body, b)
-	var event backend.Event
-	if err := json.NewDecoder(reader).Decode(&event); err != nil {
-		glog.Fatal(err)
+// waitStatus is 200 if all backends handled the event, 504 if some are still busy, 502 if some failed
+// and 202 if a follower accepted the event
+func waitStatus(outcomes []dispatcher.Outcome) int {
+	status := http.StatusOK
+	for _, outcome := range outcomes {
+		switch outcome.Status {
+		case dispatcher.OutcomePending:
+			return http.StatusGatewayTimeout
+		case dispatcher.OutcomeFailed, dispatcher.OutcomeDropped:
+			status = http.StatusBadGateway
+		case dispatcher.OutcomeStandby:
+			if status == http.StatusOK {
+				status = http.StatusAccepted
+			}
+		}
 	}
-
-	// we are done with body
-	defer r.Body.Close()
-
-	// NopCloser returns a ReadCloser with a no-op Close method wrapping the provided Reader r.
-	r.Body = ioutil.NopCloser(b)
-	return event.Eventtype
+	return status
 }
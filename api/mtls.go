@@ -0,0 +1,69 @@
+package api
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+)
+
+// clientCAs loads the CA bundle client certificates are verified against
+func clientCAs(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// clientCertAuth requires a client certificate verified during the TLS handshake. If names are given, the
+// subject common name or one of the subject alternative names of the certificate must be among them.
+func clientCertAuth(names []string) gin.HandlerFunc {
+	allowed := make(map[string]bool)
+	for _, name := range names {
+		allowed[name] = true
+	}
+	return func(ginCtx *gin.Context) {
+		tlsState := ginCtx.Request.TLS
+		if tlsState == nil || len(tlsState.VerifiedChains) == 0 {
+			glog.Warningf("rejected request without client certificate from %s to %s", ginCtx.Request.RemoteAddr, ginCtx.Request.URL.Path)
+			ginCtx.JSON(http.StatusUnauthorized, gin.H{"error": "client certificate required"})
+			ginCtx.Abort()
+			return
+		}
+		certificate := tlsState.VerifiedChains[0][0]
+		if len(allowed) > 0 && !allowedClient(certificate, allowed) {
+			glog.Warningf("rejected client certificate '%s' from %s to %s", certificate.Subject.CommonName, ginCtx.Request.RemoteAddr, ginCtx.Request.URL.Path)
+			ginCtx.JSON(http.StatusForbidden, gin.H{"error": "client certificate is not allowed"})
+			ginCtx.Abort()
+			return
+		}
+		ginCtx.Next()
+	}
+}
+
+// allowedClient reports whether the subject common name or a subject alternative name of the certificate is allowed
+func allowedClient(certificate *x509.Certificate, allowed map[string]bool) bool {
+	names := []string{certificate.Subject.CommonName}
+	names = append(names, certificate.DNSNames...)
+	names = append(names, certificate.EmailAddresses...)
+	for _, ip := range certificate.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range certificate.URIs {
+		names = append(names, uri.String())
+	}
+	for _, name := range names {
+		if name != "" && allowed[name] {
+			return true
+		}
+	}
+	return false
+}
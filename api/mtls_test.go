@@ -0,0 +1,87 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// issue creates a certificate for the name, signed by the parent or self-signed if the parent is nil
+func issue(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name + ".example.org"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func Test_clientCertAuth(t *testing.T) {
+	ca := issue(t, "Howler Test CA", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	router := gin.New()
+	router.Use(clientCertAuth([]string{"marathon.example.org"}))
+	router.POST("/events", func(ginCtx *gin.Context) { ginCtx.String(http.StatusOK, "ok") })
+	server := httptest.NewUnstartedServer(router)
+	server.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+
+	post := func(certificates ...tls.Certificate) int {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certificates
+		res, err := (&http.Client{Transport: transport}).Post(server.URL+"/events", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if status := post(issue(t, "marathon", &ca)); status != http.StatusOK {
+		fmt.Printf("Expected an allowed client to pass, got: %d\n", status)
+		t.FailNow()
+	}
+	if status := post(issue(t, "intruder", &ca)); status != http.StatusForbidden {
+		fmt.Printf("Expected a client not allowed to be forbidden, got: %d\n", status)
+		t.FailNow()
+	}
+	if status := post(); status != http.StatusUnauthorized {
+		fmt.Printf("Expected a request without client certificate to be unauthorized, got: %d\n", status)
+		t.FailNow()
+	}
+}
@@ -1,11 +1,14 @@
 package api
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
@@ -15,6 +18,7 @@ import (
 	"github.com/zalando-techmonkeys/gin-oauth2"
 	"github.com/zalando-techmonkeys/gin-oauth2/zalando"
 	"github.com/zalando-techmonkeys/howler/conf"
+	"github.com/zalando-techmonkeys/howler/dispatcher"
 	"golang.org/x/oauth2"
 	"gopkg.in/mcuadros/go-monitor.v1/aspects"
 )
@@ -30,7 +34,10 @@ type ServerSettings struct {
 var config ServerSettings
 
 //Service Struct
-type Service struct{}
+type Service struct {
+	mutex  sync.Mutex
+	server *http.Server
+}
 
 //Run starts Howler
 func (svc *Service) Run(cfg ServerSettings) error {
@@ -51,8 +58,8 @@ func (svc *Service) Run(cfg ServerSettings) error {
 	// use glog for logging
 	router.Use(ginglog.Logger(config.Configuration.LogFlushInterval))
 	// monitoring GO internals and counter middleware
-	counterAspect := &ginmon.CounterAspect{0}
-	asps := []aspects.Aspect{counterAspect}
+	counterAspect := &ginmon.CounterAspect{Count: 0}
+	asps := []aspects.Aspect{counterAspect, &dispatcher.QueueAspect{}, &dispatcher.DeadLetterAspect{}, &dispatcher.RejectedAspect{}, &dispatcher.DuplicatesAspect{}, &dispatcher.LeaderAspect{}, &CallbackAspect{}}
 	router.Use(ginmon.CounterHandler(counterAspect))
 	router.Use(gomonitor.Metrics(9000, asps))
 	router.Use(ginoauth2.RequestLogger([]string{"uid", "team"}, "data"))
@@ -71,15 +78,71 @@ func (svc *Service) Run(cfg ServerSettings) error {
 		private.Use(ginoauth2.Auth(zalando.UidCheck, oauth2Endpoint))
 	}
 
+	// event callbacks are verified in addition to OAuth2, if configured
+	verifyCallback, err := callbackAuth(config.Configuration.Callback)
+	if err != nil {
+		return err
+	}
+	// client certificates are requested during the TLS handshake, but only required on the event and admin routes
+	var requireClientCert gin.HandlerFunc
+	if config.Configuration.ClientCAFile != "" {
+		if config.Httponly {
+			return fmt.Errorf("client certificates can only be verified with TLS enabled")
+		}
+		requireClientCert = clientCertAuth(config.Configuration.AllowedClients)
+	}
+	var events *gin.RouterGroup
 	router.GET("/", rootHandler)
 	if config.Configuration.Oauth2Enabled {
 		//authenticated routes
 		private.GET("/status", getStatus)
-		private.POST("/events", createEvent)
+		private.GET("/health", getHealth)
+		private.GET("/state", getState)
+		events = private.Group("")
 	} else {
 		//non authenticated routes
 		router.GET("/status", getStatus)
-		router.POST("/events", createEvent)
+		router.GET("/health", getHealth)
+		router.GET("/state", getState)
+		events = router.Group("")
+	}
+	if requireClientCert != nil {
+		events.Use(requireClientCert)
+	}
+	events.Use(verifyCallback)
+	events.POST("/events", createEvent)
+	events.POST("/events/batch", createEvents)
+	events.POST("/clusters/:cluster/events", createEvent)
+	events.POST("/clusters/:cluster/events/batch", createEvents)
+
+	// admin routes, secured by OAuth2, by the admin token or by client certificates
+	var admin *gin.RouterGroup
+	if config.Configuration.Oauth2Enabled {
+		admin = private.Group("/admin")
+	} else if config.Configuration.AdminToken != "" || requireClientCert != nil {
+		admin = router.Group("/admin")
+		if config.Configuration.AdminToken != "" {
+			admin.Use(adminAuth(config.Configuration.AdminToken))
+		}
+	}
+	if admin != nil && requireClientCert != nil {
+		admin.Use(requireClientCert)
+	}
+	if admin != nil {
+		admin.POST("/replay", replayEvents)
+		admin.GET("/deadletters/:backend", listDeadLetters)
+		admin.GET("/deadletters/:backend/:id", getDeadLetter)
+		admin.POST("/deadletters/:backend/:id/redrive", redriveDeadLetter)
+		admin.DELETE("/deadletters/:backend/:id", discardDeadLetter)
+		admin.GET("/reconcile", lastReconciliation)
+		admin.POST("/reconcile", reconcileBackends)
+		admin.POST("/reload", reloadConfig)
+		admin.GET("/backends", listBackends)
+		admin.POST("/backends/:backend/pause", setBackendState(dispatcher.BackendPaused))
+		admin.POST("/backends/:backend/resume", setBackendState(dispatcher.BackendActive))
+		admin.POST("/backends/:backend/disable", setBackendState(dispatcher.BackendDisabled))
+	} else {
+		glog.Warningf("admin API is disabled, enable OAuth2 or configure an admin token or client CA")
 	}
 
 	// TLS config
@@ -88,6 +151,14 @@ func (svc *Service) Run(cfg ServerSettings) error {
 		tlsConfig.Certificates = []tls.Certificate{config.CertKeyPair}
 		tlsConfig.NextProtos = []string{"http/1.1"}
 		tlsConfig.Rand = rand.Reader // Strictly not necessary, should be default
+		if config.Configuration.ClientCAFile != "" {
+			pool, err := clientCAs(config.Configuration.ClientCAFile)
+			if err != nil {
+				return fmt.Errorf("unable to load client CA: %s", err)
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
 	}
 
 	// run frontend server
@@ -96,8 +167,13 @@ func (svc *Service) Run(cfg ServerSettings) error {
 		Handler:   router,
 		TLSConfig: &tlsConfig,
 	}
+	svc.mutex.Lock()
+	svc.server = serve
+	svc.mutex.Unlock()
 	if config.Httponly {
-		serve.ListenAndServe()
+		if err := serve.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			return err
+		}
 	} else {
 		conn, err := net.Listen("tcp", serve.Addr)
 		if err != nil {
@@ -105,9 +181,22 @@ func (svc *Service) Run(cfg ServerSettings) error {
 		}
 		tlsListener := tls.NewListener(conn, &tlsConfig)
 		err = serve.Serve(tlsListener)
-		if err != nil {
+		if err != nil && err != http.ErrServerClosed {
 			glog.Fatalf("Can not Serve TLS, caused by: %s\n", err)
 		}
 	}
 	return nil
 }
+
+//Shutdown stops the server, requests which are still served get up to timeout to finish
+func (svc *Service) Shutdown(timeout time.Duration) error {
+	svc.mutex.Lock()
+	serve := svc.server
+	svc.mutex.Unlock()
+	if serve == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return serve.Shutdown(ctx)
+}
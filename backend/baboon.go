@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/zalando-techmonkeys/howler/conf"
+	"github.com/zalando-techmonkeys/howler/state"
 	"gopkg.in/jmcvetta/napping.v3"
 	"io/ioutil"
 	"net"
@@ -123,22 +124,64 @@ func (be *Baboon) getToken() string {
 }
 
 // HandleUpdate adds or removes container to loadbalancer pool
-func (be *Baboon) HandleUpdate(e StatusUpdateEvent) {
-	be.modify(e)
+func (be *Baboon) HandleUpdate(e StatusUpdateEvent) error {
+	return be.inCluster(e.Cluster).modify(e)
 }
 
 // HandleCreate creates new LTM pools, GTM pools and GTM wideip
-func (be *Baboon) HandleCreate(e APIRequestEvent) {
-	be.create(e)
+func (be *Baboon) HandleCreate(e APIRequestEvent) error {
+	return be.inCluster(e.Cluster).create(e)
 }
 
 // HandleDestroy deletes LTM pools, GTM pools and GTM wideip
-func (be *Baboon) HandleDestroy(e AppTerminatedEvent) {
-	be.destroy(e)
+func (be *Baboon) HandleDestroy(e AppTerminatedEvent) error {
+	return be.inCluster(e.Cluster).destroy(e)
+}
+
+// inCluster returns a copy of the backend with the current config for events of the cluster
+func (be *Baboon) inCluster(cluster string) *Baboon {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	clustered := *be
+	if cluster != "" {
+		clustered.config = conf.New().BackendConfig("baboon", cluster)
+	}
+	return &clustered
+}
+
+// CheckConfig requires the loadbalancer list, if Baboon is configured for a cluster
+func (be *Baboon) CheckConfig(config *conf.Config) error {
+	return checkClusters(config, "baboon", func(baboon map[string]string) error {
+		if len(baboon) > 0 && strings.Trim(baboon["loadbalancer"], ", ") == "" {
+			return fmt.Errorf("loadbalancer is empty")
+		}
+		return nil
+	})
+}
+
+// UseConfig applies the reloaded config to the events handled from now on
+func (be *Baboon) UseConfig(config *conf.Config) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	be.config = config.BackendConfig("baboon", "")
+}
+
+// CheckHealth pings baboon-proxy
+func (be *Baboon) CheckHealth() error {
+	be = be.inCluster("")
+	if be.config["entityLTMService"] == "" {
+		return fmt.Errorf("entityLTMService is empty")
+	}
+	req, err := http.NewRequest("GET", be.config["entityLTMService"], nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", be.getToken()))
+	return ping(req)
 }
 
 // destroy calls baboon-proxy to destroy LTM pools, GTM pool and GTM wideip
-func (be *Baboon) destroy(e AppTerminatedEvent) {
+func (be *Baboon) destroy(e AppTerminatedEvent) error {
 	var (
 		response *napping.Response
 		wait     sync.WaitGroup
@@ -148,55 +191,65 @@ func (be *Baboon) destroy(e AppTerminatedEvent) {
 	loadbalancerSlice := strings.Split(be.config["loadbalancer"], ",")
 	token := be.getToken()
 	be.session.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	errs := make(chan error, len(loadbalancerSlice))
 	wait.Add(len(loadbalancerSlice))
 	for i := range loadbalancerSlice {
 		// running multiple go routines to delete LTM pools concurrently
 		// otherwise it's to slow waiting for each LTM
-		go be.destroyLTMPool(loadbalancerSlice[i], e, poolName, &wait)
+		go be.destroyLTMPool(loadbalancerSlice[i], e, poolName, &wait, errs)
 	}
 	// wait for destroying all LTM pools
 	wait.Wait()
+	close(errs)
+	if err := firstError(errs); err != nil {
+		return err
+	}
 	// calls baboon-proxy to delete GTM wideip and pool
 	baboonGTMEndpoint := fmt.Sprintf("%s%s/wideips/%s.%s",
 		be.config["entityGTMService"], be.config["trafficManager"], appName, be.config["gtmDomain"])
 	u, err := url.Parse(baboonGTMEndpoint)
 	if err != nil {
 		glog.Errorf("unable to parse rawurl, reason %s", err)
-		return
+		return Permanent(err)
 	}
 	glog.Infof("about to delete F5 GTM wideip entity with AppID '%s' via calling '%s'", e.Appid, baboonGTMEndpoint)
 
 	response, err = be.session.Delete(u.String(), nil, nil, nil)
 	if err != nil {
 		glog.Errorf("unable to delete GTM wideip '%s.%s'", appName, be.config["gtmDomain"])
-		return
+		return err
 	}
 	glog.Infof("DELETE response (%d): %s", response.Status(), response.RawText())
+	if err := responseError(response.Status(), fmt.Sprintf("deleting GTM wideip '%s.%s'", appName, be.config["gtmDomain"])); err != nil {
+		return err
+	}
 	baboonGTMEndpoint = fmt.Sprintf("%s%s/pools/%s",
 		be.config["entityGTMService"], be.config["trafficManager"], poolName)
 	u, err = url.Parse(baboonGTMEndpoint)
 	if err != nil {
 		glog.Errorf("unable to parse rawurl, reason %s", err)
-		return
+		return Permanent(err)
 	}
 	glog.Infof("about to delete F5 GTM pool entity with AppID '%s' via calling '%s'", e.Appid, baboonGTMEndpoint)
 
 	response, err = be.session.Delete(u.String(), nil, nil, nil)
 	if err != nil {
 		glog.Errorf("unable to add GTM pool '%s'", poolName)
-		return
+		return err
 	}
 	glog.Infof("DELETE response (%d): %s", response.Status(), response.RawText())
+	return responseError(response.Status(), fmt.Sprintf("deleting GTM pool '%s'", poolName))
 }
 
 // destroyLTMPool calls baboon-proxy destroying all pools in all DCs concurrently
-func (be *Baboon) destroyLTMPool(loadbalancer string, e AppTerminatedEvent, poolName string, wait *sync.WaitGroup) {
+func (be *Baboon) destroyLTMPool(loadbalancer string, e AppTerminatedEvent, poolName string, wait *sync.WaitGroup, errs chan<- error) {
 	defer wait.Done()
 	baboonEndpoint := fmt.Sprintf("%s%s/pools/%s",
 		be.config["entityLTMService"], loadbalancer, poolName)
 	u, err := url.Parse(baboonEndpoint)
 	if err != nil {
 		glog.Errorf("unable to parse rawurl, reason %s", err)
+		errs <- Permanent(err)
 		return
 	}
 	glog.Infof("about to remove F5 pool entity with AppID '%s' via calling '%s'", e.Appid, baboonEndpoint)
@@ -204,14 +257,15 @@ func (be *Baboon) destroyLTMPool(loadbalancer string, e AppTerminatedEvent, pool
 	response, err := be.session.Delete(u.String(), nil, nil, nil)
 	if err != nil {
 		glog.Errorf("unable to remove pool '%s'", poolName)
+		errs <- err
 		return
 	}
 	glog.Infof("DELETE response (%d): %s", response.Status(), response.RawText())
-	return
+	errs <- responseError(response.Status(), fmt.Sprintf("removing pool '%s' on %s", poolName, loadbalancer))
 }
 
 // create calls baboon-proxy to create LTM pools, GTM pool and GTM wideip
-func (be *Baboon) create(e APIRequestEvent) {
+func (be *Baboon) create(e APIRequestEvent) error {
 	var (
 		response *napping.Response
 		wait     sync.WaitGroup
@@ -222,6 +276,10 @@ func (be *Baboon) create(e APIRequestEvent) {
 	loadbalancerSlice := strings.Split(be.config["loadbalancer"], ",")
 	virtualServerSlice := strings.Split(be.config["virtualServer"], ",")
 	fmt.Println(loadbalancerSlice)
+	if len(virtualServerSlice) < len(loadbalancerSlice) {
+		return Permanent(fmt.Errorf("baboon config lists %d loadbalancers, but only %d virtual servers",
+			len(loadbalancerSlice), len(virtualServerSlice)))
+	}
 	token := be.getToken()
 	be.session.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 	payloadLTM := addLTMPool{Name: poolName, Monitor: be.config["ltmPoolMonitor"]}
@@ -238,55 +296,65 @@ func (be *Baboon) create(e APIRequestEvent) {
 	payloadGTMWideip.Pools = append(payloadGTMWideip.Pools, addGTMWideIPPool{Name: poolName})
 	payloadGTMWideip.PoolLBMode = be.config["gtmWideipMonitor"]
 
+	errs := make(chan error, len(loadbalancerSlice))
 	wait.Add(len(loadbalancerSlice))
 	for i := range loadbalancerSlice {
 		// running multiple go routines to create LTM pools concurrently
 		// otherwise it's to slow for incoming status_update_events
 		// LTM pool members can only be modified if the LTM pool already exists
-		go be.createLTMPool(loadbalancerSlice[i], e, poolName, payloadLTM, &wait)
+		go be.createLTMPool(loadbalancerSlice[i], e, poolName, payloadLTM, &wait, errs)
 	}
 	// wait for creating all LTM pools
 	wait.Wait()
+	close(errs)
+	if err := firstError(errs); err != nil {
+		return err
+	}
 	// calls baboon-proxy to create GTM pool and wideip
 	baboonGTMEndpoint := fmt.Sprintf("%s%s/pools", be.config["entityGTMService"],
 		be.config["trafficManager"])
 	u, err := url.Parse(baboonGTMEndpoint)
 	if err != nil {
 		glog.Errorf("unable to parse rawurl, reason %s", err)
-		return
+		return Permanent(err)
 	}
 	glog.Infof("about to add F5 GTM pool entity with AppID '%s' via calling '%s'", e.Appdefinition.ID, baboonGTMEndpoint)
 
 	response, err = be.session.Post(u.String(), payloadGTMPool, nil, nil)
 	if err != nil {
 		glog.Errorf("unable to add GTM pool '%s'", poolName)
-		return
+		return err
 	}
 	glog.Infof("POST response (%d): %s", response.Status(), response.RawText())
+	if err := responseError(response.Status(), fmt.Sprintf("adding GTM pool '%s'", poolName)); err != nil {
+		return err
+	}
 	baboonGTMEndpoint = fmt.Sprintf("%s%s/wideips", be.config["entityGTMService"],
 		be.config["trafficManager"])
 	u, err = url.Parse(baboonGTMEndpoint)
 	if err != nil {
 		glog.Errorf("unable to parse rawurl, reason %s", err)
-		return
+		return Permanent(err)
 	}
 	glog.Infof("about to add F5 GTM wideip entity with AppID '%s' via calling '%s'", e.Appdefinition.ID, baboonGTMEndpoint)
 
 	response, err = be.session.Post(u.String(), payloadGTMWideip, nil, nil)
 	if err != nil {
 		glog.Errorf("unable to create GTM wideip '%s'", payloadGTMWideip.Name)
-		return
+		return err
 	}
 	glog.Infof("POST response (%d): %s", response.Status(), response.RawText())
+	return responseError(response.Status(), fmt.Sprintf("creating GTM wideip '%s'", payloadGTMWideip.Name))
 }
 
 // createLTMPool calls baboon-proxy creating all pools in all DCs concurrently
-func (be *Baboon) createLTMPool(loadbalancer string, e APIRequestEvent, poolName string, payloadLTM addLTMPool, wait *sync.WaitGroup) {
+func (be *Baboon) createLTMPool(loadbalancer string, e APIRequestEvent, poolName string, payloadLTM addLTMPool, wait *sync.WaitGroup, errs chan<- error) {
 	defer wait.Done()
 	baboonLTMEndpoint := fmt.Sprintf("%s%s/pools", be.config["entityLTMService"], loadbalancer)
 	u, err := url.Parse(baboonLTMEndpoint)
 	if err != nil {
 		glog.Errorf("unable to parse rawurl, reason %s", err)
+		errs <- Permanent(err)
 		return
 	}
 	glog.Infof("about to add F5 LTM pool entity with AppID '%s' via calling '%s'", e.Appdefinition.ID, baboonLTMEndpoint)
@@ -294,18 +362,26 @@ func (be *Baboon) createLTMPool(loadbalancer string, e APIRequestEvent, poolName
 	response, err := be.session.Post(u.String(), payloadLTM, nil, nil)
 	if err != nil {
 		glog.Errorf("unable to add LTM pool '%s'", poolName)
+		errs <- err
 		return
 	}
 	glog.Infof("POST response (%d): %s", response.Status(), response.RawText())
-	return
+	errs <- responseError(response.Status(), fmt.Sprintf("adding LTM pool '%s' on %s", poolName, loadbalancer))
 }
 
-// modify calls baboon-proxy to add or delete members in LTM pools
-func (be *Baboon) modify(e StatusUpdateEvent) {
-	var (
-		response *napping.Response
-		entity   LTMPoolService
-	)
+// firstError returns the first error sent by the concurrent LTM calls
+func firstError(errs <-chan error) error {
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poolMember returns the LTM pool member of the task reported by the event
+func (be *Baboon) poolMember(e StatusUpdateEvent) (LTMPoolService, error) {
+	var entity LTMPoolService
 	entity.Ports = make(map[int]int)
 	for i, port := range e.Ports {
 		entity.Ports[i] = port
@@ -318,12 +394,22 @@ func (be *Baboon) modify(e StatusUpdateEvent) {
 
 	host := strings.Split(e.Host, ".")[0]
 	host = fmt.Sprintf("%s.%s", host, be.config["domain"])
-	ip, err := net.LookupHost(host)
+	ip, err := lookupHost(host)
 	if err != nil {
 		glog.Errorf("unable to lookup host %s", host)
-		return
+		return entity, err
 	}
 	entity.PoolMember = fmt.Sprintf("%s:%s", ip[0], strconv.Itoa(entity.Ports[0]))
+	return entity, nil
+}
+
+// modify calls baboon-proxy to add or delete members in LTM pools
+func (be *Baboon) modify(e StatusUpdateEvent) error {
+	var response *napping.Response
+	entity, err := be.poolMember(e)
+	if err != nil {
+		return err
+	}
 
 	token := be.getToken()
 	urlLTMMembers := fmt.Sprintf("%s%s/pools/%s/members", be.config["entityLTMService"],
@@ -331,7 +417,7 @@ func (be *Baboon) modify(e StatusUpdateEvent) {
 	u, err := url.Parse(urlLTMMembers)
 	if err != nil {
 		glog.Errorf("unable to parse rawurl, reason %s", err)
-		return
+		return Permanent(err)
 	}
 	glog.Infof("about to modify F5 pool member entity with TaskID '%s' via calling '%s'",
 		e.Taskid, u.String())
@@ -344,45 +430,177 @@ func (be *Baboon) modify(e StatusUpdateEvent) {
 			Description: entity.PoolMemberDescription}, nil, nil)
 		if err != nil {
 			glog.Errorf("unable to add pool member '%s', reason: %s", entity.PoolMember, err)
-			return
+			return err
 		}
 		glog.Infof("POST response (%d): %s", response.Status(), response.RawText())
+		return responseError(response.Status(), fmt.Sprintf("adding pool member '%s'", entity.PoolMember))
 	case e.Taskstatus == "TASK_KILLED":
-		// napping doesn't support payload for DELETE methods
-		// using plain http client to delete pool member
 		entity.Type = "Delete pool member"
-		payload := deleteLTMPoolMember{Name: entity.PoolMember}
-		buf, err := json.Marshal(payload)
-		if err != nil {
-			glog.Errorf("can not marshal entity, reason %s", err)
-			return
+		return be.removeMember(u.String(), entity.PoolMember, token)
+	default:
+		entity.Type = "Unknown type"
+		glog.Error(entity.Type)
+	}
+	return nil
+}
+
+// removeMember calls baboon-proxy to delete a member of an LTM pool
+func (be *Baboon) removeMember(membersURL string, member string, token string) error {
+	// napping doesn't support payload for DELETE methods
+	// using plain http client to delete pool member
+	payload := deleteLTMPoolMember{Name: member}
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		glog.Errorf("can not marshal entity, reason %s", err)
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequest("DELETE", membersURL,
+		bytes.NewBuffer(buf)) // <-- URL-encoded payload
+	if err != nil {
+		glog.Errorf("unable make a new request, reason: %s", err)
+		return Permanent(err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("Content-Type", "application/json")
+	c := &http.Client{}
+	rsp, err := c.Do(req)
+	if rsp != nil {
+		defer rsp.Body.Close()
+	}
+	if err != nil {
+		glog.Errorf("unable to remove pool member '%s'", member)
+		return err
+	}
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		glog.Errorf("unable to read response body, reason %s", err)
+		return err
+	}
+	glog.Infof("DELETE response (%s): %s", rsp.Status, string(body))
+	return responseError(rsp.StatusCode, fmt.Sprintf("removing pool member '%s'", member))
+}
+
+// lookupHost resolves the hosts of the tasks, tests replace it
+var lookupHost = net.LookupHost
+
+// ltmPoolMembers inherits the fields of the
+// members of a pool LTM as listed by baboon-proxy
+type ltmPoolMembers struct {
+	Items []struct {
+		Name string `json:"name"`
+	} `json:"items"`
+}
+
+// sharedLoadbalancers returns the loadbalancers further clusters use, their pools hold members of tasks
+// which are not part of the snapshot of the default cluster
+func sharedLoadbalancers() map[string]bool {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	config := conf.New()
+	shared := make(map[string]bool)
+	for cluster := range config.Clusters {
+		for _, loadbalancer := range strings.Split(config.BackendConfig("baboon", cluster)["loadbalancer"], ",") {
+			shared[loadbalancer] = true
 		}
+	}
+	return shared
+}
 
-		req, err := http.NewRequest("DELETE", u.String(),
-			bytes.NewBuffer(buf)) // <-- URL-encoded payload
+// Reconcile adds the running tasks missing in the LTM pools of their apps and removes the members
+// of tasks which are gone. Pools which do not exist are left to HandleCreate. Nothing is removed
+// from the pools of an app if the host of one of its tasks can not be resolved, nor from the pools
+// on loadbalancers further clusters use as well. Only the pools of routed apps are touched.
+func (be *Baboon) Reconcile(cluster state.Snapshot, _ state.Snapshot) ([]Change, error) {
+	be = be.inCluster("")
+	shared := sharedLoadbalancers()
+	// desired members per loadbalancer and pool
+	desired := make(map[string]map[string]bool)
+	type member struct {
+		event  StatusUpdateEvent
+		entity LTMPoolService
+	}
+	var running []member
+	var firstErr error
+	// pools with a task whose member is unknown, their members must not be taken for stale ones
+	unresolved := make(map[string]bool)
+	for _, task := range cluster.Tasks {
+		if task.Status != "TASK_RUNNING" || len(task.Ports) == 0 {
+			continue
+		}
+		e := taskEvent(task)
+		entity, err := be.poolMember(e)
 		if err != nil {
-			glog.Errorf("unable make a new request, reason: %s", err)
-			return
+			if firstErr == nil {
+				firstErr = err
+			}
+			unresolved[entity.Pool] = true
+			continue
 		}
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-		req.Header.Set("Content-Type", "application/json")
-		c := &http.Client{}
-		rsp, err := c.Do(req)
-		if rsp != nil {
-			defer rsp.Body.Close()
+		pool := entity.Loadbalancer + "/" + entity.Pool
+		if desired[pool] == nil {
+			desired[pool] = make(map[string]bool)
 		}
-		if err != nil {
-			glog.Errorf("unable to remove pool member '%s'", entity.PoolMember)
-			return
+		desired[pool][entity.PoolMember] = true
+		running = append(running, member{e, entity})
+	}
+
+	token := be.getToken()
+	be.session.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	var changes []Change
+	existing := make(map[string]map[string]bool)
+	for _, app := range cluster.Apps {
+		poolName := fmt.Sprintf("%s%s", be.config["ltmPoolPrefix"], strings.TrimLeft(app.ID, "/"))
+		for _, loadbalancer := range strings.Split(be.config["loadbalancer"], ",") {
+			pool := loadbalancer + "/" + poolName
+			membersURL := fmt.Sprintf("%s%s/pools/%s/members", be.config["entityLTMService"], loadbalancer, poolName)
+			var members ltmPoolMembers
+			response, err := be.session.Get(membersURL, nil, &members, nil)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if response.Status() == http.StatusNotFound {
+				continue
+			}
+			if err := responseError(response.Status(), fmt.Sprintf("listing members of pool '%s'", pool)); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			existing[pool] = make(map[string]bool)
+			for _, item := range members.Items {
+				existing[pool][item.Name] = true
+				if desired[pool][item.Name] || unresolved[poolName] || shared[loadbalancer] {
+					continue
+				}
+				if err := be.removeMember(membersURL, item.Name, token); err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					continue
+				}
+				changes = append(changes, Change{Action: ChangeRemoved, Resource: fmt.Sprintf("member %s of pool %s", item.Name, pool)})
+			}
 		}
-		body, err := ioutil.ReadAll(rsp.Body)
-		if err != nil {
-			glog.Errorf("unable to read response body, reason %s", err)
-			return
+	}
+	for _, m := range running {
+		entity := m.entity
+		pool := entity.Loadbalancer + "/" + entity.Pool
+		if members, ok := existing[pool]; !ok || members[entity.PoolMember] {
+			// the pool does not exist or the member is in place
+			continue
 		}
-		glog.Infof("DELETE response (%s): %s", rsp.Status, string(body))
-	default:
-		entity.Type = "Unknown type"
-		glog.Errorf(entity.Type)
+		if err := be.modify(m.event); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		changes = append(changes, Change{Action: ChangeAdded, Resource: fmt.Sprintf("member %s of pool %s", entity.PoolMember, pool)})
 	}
+	return changes, firstErr
 }
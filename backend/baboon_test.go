@@ -0,0 +1,131 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zalando-techmonkeys/howler/conf"
+	"github.com/zalando-techmonkeys/howler/state"
+	"gopkg.in/jmcvetta/napping.v3"
+)
+
+//baboonStandIn serves the LTM pool members of baboon-proxy
+type baboonStandIn struct {
+	sync.Mutex
+	members map[string][]string // by "<loadbalancer>/pools/<pool>"
+	removed []string
+}
+
+func (m *baboonStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+	pool := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/members")
+	switch r.Method {
+	case "GET":
+		members, ok := m.members[pool]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var list ltmPoolMembers
+		for _, member := range members {
+			list.Items = append(list.Items, struct {
+				Name string `json:"name"`
+			}{member})
+		}
+		json.NewEncoder(w).Encode(list)
+	case "DELETE":
+		var member deleteLTMPoolMember
+		json.NewDecoder(r.Body).Decode(&member)
+		m.removed = append(m.removed, pool+"/"+member.Name)
+	}
+}
+
+func Test_BaboonReconcile(t *testing.T) {
+	standIn := &baboonStandIn{members: map[string][]string{
+		"a-ltm/pools/my-app":    {"10.0.0.1:31000", "10.0.0.2:31000"},
+		"a-ltm/pools/other-app": {"10.0.0.3:31001", "10.0.0.4:31001"},
+	}}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	conf.Use(&conf.Config{})
+	defer conf.Use(nil)
+	defer func(lookup func(string) ([]string, error)) { lookupHost = lookup }(lookupHost)
+	lookupHost = func(host string) ([]string, error) {
+		switch host {
+		case "a-good.example.org":
+			return []string{"10.0.0.1"}, nil
+		case "a-other.example.org":
+			return []string{"10.0.0.3"}, nil
+		}
+		return nil, fmt.Errorf("lookup %s: no such host", host)
+	}
+	be := &Baboon{
+		name:    "Baboon",
+		session: &napping.Session{Header: &http.Header{}},
+		config:  map[string]string{"entityLTMService": server.URL + "/", "loadbalancer": "a-ltm", "domain": "example.org"},
+	}
+
+	snapshot := state.Snapshot{
+		Apps: []state.App{{ID: "/my-app"}, {ID: "/other-app"}},
+		Tasks: []state.Task{
+			{ID: "good", AppID: "/my-app", Host: "a-good", Ports: []int{31000}, Status: "TASK_RUNNING"},
+			{ID: "flaky", AppID: "/my-app", Host: "a-flaky", Ports: []int{31000}, Status: "TASK_RUNNING"},
+			{ID: "other", AppID: "/other-app", Host: "a-other", Ports: []int{31001}, Status: "TASK_RUNNING"},
+		},
+	}
+	changes, err := be.Reconcile(snapshot, snapshot)
+	if err == nil {
+		fmt.Println("Expected the failed lookup to be reported")
+		t.FailNow()
+	}
+	// the member of the task which could not be resolved is kept, stale members of other pools are removed
+	if len(standIn.removed) != 1 || standIn.removed[0] != "a-ltm/pools/other-app/10.0.0.4:31001" {
+		fmt.Printf("Expected only the stale member of other-app to be removed, got: %v\n", standIn.removed)
+		t.FailNow()
+	}
+	if len(changes) != 1 || changes[0].Action != ChangeRemoved {
+		fmt.Printf("Unexpected changes: %+v\n", changes)
+		t.FailNow()
+	}
+}
+
+func Test_BaboonReconcileClusters(t *testing.T) {
+	// both clusters run my-app, the eu-west one only on b-ltm
+	standIn := &baboonStandIn{members: map[string][]string{
+		"a-ltm/pools/my-app": {"10.0.0.1:31000", "10.0.0.2:31000"},
+		"b-ltm/pools/my-app": {"10.0.0.1:31000", "10.1.0.1:31000"},
+	}}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	conf.Use(&conf.Config{Clusters: map[string]conf.Cluster{
+		"eu-west": {Backends: map[string]map[string]string{"baboon": {"loadbalancer": "b-ltm"}}},
+	}})
+	defer conf.Use(nil)
+	defer func(lookup func(string) ([]string, error)) { lookupHost = lookup }(lookupHost)
+	lookupHost = func(host string) ([]string, error) { return []string{"10.0.0.1"}, nil }
+	be := &Baboon{
+		name:    "Baboon",
+		session: &napping.Session{Header: &http.Header{}},
+		config:  map[string]string{"entityLTMService": server.URL + "/", "loadbalancer": "a-ltm,b-ltm", "domain": "example.org"},
+	}
+
+	snapshot := state.Snapshot{
+		Apps:  []state.App{{ID: "/my-app"}},
+		Tasks: []state.Task{{ID: "good", AppID: "/my-app", Host: "a-good", Ports: []int{31000}, Status: "TASK_RUNNING"}},
+	}
+	_, err := be.Reconcile(snapshot, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the member of eu-west on the shared loadbalancer is kept
+	if len(standIn.removed) != 1 || standIn.removed[0] != "a-ltm/pools/my-app/10.0.0.2:31000" {
+		fmt.Printf("Expected only the stale member on the unshared loadbalancer to be removed, got: %v\n", standIn.removed)
+		t.FailNow()
+	}
+}
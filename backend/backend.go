@@ -1,5 +1,11 @@
 package backend
 
+//Plugin is implemented by every backend, which implements Backend or ReportingBackend on top of it
+type Plugin interface {
+	Name() string
+	Register() error // this is for initializing stuff, establishing connections etc.
+}
+
 //Backend provides general methods
 type Backend interface {
 	Name() string
@@ -8,3 +14,56 @@ type Backend interface {
 	HandleUpdate(StatusUpdateEvent)
 	HandleDestroy(AppTerminatedEvent)
 }
+
+//ReportingBackend provides the general methods of Backend, but its handlers report failures, so the
+//dispatcher can retry them. Return a PermanentError for failures which will not go away by retrying.
+//The handlers of a Backend are taken as always successful.
+type ReportingBackend interface {
+	Name() string
+	Register() error
+	HandleCreate(APIRequestEvent) error
+	HandleUpdate(StatusUpdateEvent) error
+	HandleDestroy(AppTerminatedEvent) error
+}
+
+// The following interfaces are optional. The dispatcher checks every registered backend
+// for them, so a backend only has to implement the ones for the events it is interested in.
+
+//HealthEventHandler is implemented by backends reacting on health check events
+type HealthEventHandler interface {
+	HandleHealthCheckAdded(AddHealthCheckEvent) error
+	HandleHealthCheckRemoved(RemoveHealthCheckEvent) error
+	HandleHealthCheckFailed(FailedHealthCheckEvent) error
+	HandleHealthStatusChanged(HealthStatusChangedEvent) error
+}
+
+//DeploymentEventHandler is implemented by backends reacting on deployment events
+type DeploymentEventHandler interface {
+	HandleDeploymentSuccess(DeploymentSuccessEvent) error
+	HandleDeploymentFailed(DeploymentFailedEvent) error
+	HandleDeploymentInfo(DeploymentInfoEvent) error
+	HandleDeploymentStepSuccess(DeploymentStepSuccessEvent) error
+	HandleDeploymentStepFailure(DeploymentStepFailureEvent) error
+}
+
+//GroupEventHandler is implemented by backends reacting on group change events
+type GroupEventHandler interface {
+	HandleGroupChangeSuccess(GroupChangeSuccessEvent) error
+	HandleGroupChangeFailed(GroupChangeFailedEvent) error
+}
+
+//FrameworkMessageHandler is implemented by backends reacting on framework messages
+type FrameworkMessageHandler interface {
+	HandleFrameworkMessage(FrameworkMessageEvent) error
+}
+
+//SubscriptionEventHandler is implemented by backends reacting on event bus (un)subscriptions
+type SubscriptionEventHandler interface {
+	HandleSubscribe(SubscribeEvent) error
+	HandleUnsubscribe(UnsubscribeEvent) error
+}
+
+//Closer is implemented by backends holding resources, p.e. servers, which must be released on shutdown
+type Closer interface {
+	Close() error
+}
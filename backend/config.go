@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+//configMutex guards the config of all backends. Handlers work on a copy of the backend taken
+//under the read lock, so a reloaded config applies to the next event and never to half of one.
+var configMutex sync.RWMutex
+
+//Reloadable is implemented by backends picking up a reloaded config at runtime. The dispatcher
+//checks the config with all backends before any of them uses it.
+type Reloadable interface {
+	CheckConfig(config *conf.Config) error
+	UseConfig(config *conf.Config)
+}
+
+//checkClusters calls check with the config of the backend for the default cluster and for every further cluster
+func checkClusters(config *conf.Config, name string, check func(map[string]string) error) error {
+	if err := check(config.BackendConfig(name, "")); err != nil {
+		return err
+	}
+	var clusters []string
+	for cluster := range config.Clusters {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		if err := check(config.BackendConfig(name, cluster)); err != nil {
+			return fmt.Errorf("cluster '%s': %s", cluster, err)
+		}
+	}
+	return nil
+}
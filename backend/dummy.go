@@ -21,12 +21,13 @@ func (be *DummyBackend) Register() error {
 }
 
 //HandleUpdate reaps update events from Marathon
-func (be *DummyBackend) HandleUpdate(e StatusUpdateEvent) {
+func (be *DummyBackend) HandleUpdate(e StatusUpdateEvent) error {
 	glog.Infof("%+v\n", e)
+	return nil
 }
 
 //HandleCreate reaps API request events from Marathon
-func (be *DummyBackend) HandleCreate(e APIRequestEvent) {}
+func (be *DummyBackend) HandleCreate(e APIRequestEvent) error { return nil }
 
 //HandleDestroy reaps API terminated events from Marathon
-func (be *DummyBackend) HandleDestroy(e AppTerminatedEvent) {}
+func (be *DummyBackend) HandleDestroy(e AppTerminatedEvent) error { return nil }
@@ -0,0 +1,42 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+)
+
+//PermanentError marks a failure which will not go away by retrying, p.e. an invalid app definition
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+//Permanent wraps err as PermanentError, so the dispatcher does not retry it
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+//IsPermanent reports whether err must not be retried
+func IsPermanent(err error) bool {
+	_, ok := err.(*PermanentError)
+	return ok
+}
+
+//responseError classifies the status of a response. Client errors are permanent,
+//except for timeouts and rate limiting, all others are worth a retry.
+func responseError(status int, action string) error {
+	if status >= 200 && status < 300 {
+		return nil
+	}
+	err := fmt.Errorf("%s failed with status %d", action, status)
+	if status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+//HealthChecker is implemented by backends which can tell whether the systems behind them are usable.
+//CheckHealth returns why they are not, p.e. an unreachable API or an invalid token.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+//healthTimeout bounds a single request of a health check
+const healthTimeout = 5 * time.Second
+
+//ping sends the request and fails if the service is not reachable or answers with a server error.
+//Any other answer shows the service is up, p.e. a 404 for a base URL without a resource.
+func ping(req *http.Request) error {
+	client := &http.Client{Timeout: healthTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("%s answered with status %d", req.URL, res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package backend
+
+import "github.com/zalando-techmonkeys/howler/state"
+
+// actions of a change made by a Reconciler
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+)
+
+//Reconciler is implemented by backends which can compare their resources with the cluster state.
+//Reconcile adds the resources missing for the apps and tasks of the routed snapshot, which holds the ones
+//the routing rules send events for, removes stale ones and reports the changes it made, also if it fails
+//halfway. The snapshot of all apps and tasks tells resources of tasks which are still running, but excluded
+//by routing, from stale ones.
+type Reconciler interface {
+	Reconcile(routed state.Snapshot, all state.Snapshot) ([]Change, error)
+}
+
+//Change describes a resource a Reconciler added or removed
+type Change struct {
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+}
+
+//taskEvent builds the status update a task would be reported with, so reconcilers can
+//reuse the handlers of the backend
+func taskEvent(task state.Task) StatusUpdateEvent {
+	e := StatusUpdateEvent{
+		Event:      Event{Eventtype: "status_update_event"},
+		Slaveid:    task.SlaveID,
+		Taskid:     task.ID,
+		Taskstatus: task.Status,
+		Appid:      task.AppID,
+		Host:       task.Host,
+		Ports:      task.Ports,
+		Version:    task.Version,
+	}
+	if app, ok := state.Cluster.App(task.AppID); ok {
+		e.App = &App{ID: app.ID, Instances: app.Instances, Labels: app.Labels, Version: app.Version}
+	}
+	return e
+}
@@ -1,9 +1,56 @@
 package backend
 
+import "encoding/json"
+
 //Event provides abbasic type containing only the fields all Marathon events have in common.
+//App is not part of Marathon's event, the dispatcher attaches the current definition of the
+//app the event refers to, if it is known. Cluster is not part of Marathon's event either, Howler
+//adds it to the payload of events from other clusters than the default one.
 type Event struct {
 	Eventtype string `json:"eventType"`
 	Timestamp string `json:"timestamp"`
+	Cluster   string `json:"cluster,omitempty"`
+	App       *App   `json:"-"`
+}
+
+//Type returns the eventType, it is promoted to all typed events
+func (e Event) Type() string {
+	return e.Eventtype
+}
+
+//FromCluster returns the cluster the event came from, empty for the default cluster. It is promoted to all typed events.
+func (e Event) FromCluster() string {
+	return e.Cluster
+}
+
+//Enrich attaches the app definition, it is promoted to all typed events
+func (e *Event) Enrich(app *App) {
+	e.App = app
+}
+
+//Definition returns the attached app definition or nil, it is promoted to all typed events
+func (e Event) Definition() *App {
+	return e.App
+}
+
+//PortDefinition describes a port of an app
+type PortDefinition struct {
+	Port     int               `json:"port"`
+	Protocol string            `json:"protocol"`
+	Name     string            `json:"name"`
+	Labels   map[string]string `json:"labels"`
+}
+
+//App is the definition of a Marathon app as returned by /v2/apps. It is shared by all
+//backends receiving the event, so it must not be modified.
+type App struct {
+	ID              string                 `json:"id"`
+	Instances       int                    `json:"instances"`
+	Labels          map[string]string      `json:"labels"`
+	Env             map[string]interface{} `json:"env"`
+	HealthChecks    []HealthCheck          `json:"healthChecks"`
+	PortDefinitions []PortDefinition       `json:"portDefinitions"`
+	Version         string                 `json:"version"`
 }
 
 // All following event types are generated with https://mholt.github.io/json-to-go/
@@ -16,23 +63,24 @@ type APIRequestEvent struct {
 	Clientip      string `json:"clientIp"`
 	URI           string `json:"uri"`
 	Appdefinition struct {
-		Args            []interface{} `json:"args"`
-		Backofffactor   float64       `json:"backoffFactor"`
-		Backoffseconds  int           `json:"backoffSeconds"`
-		Cmd             string        `json:"cmd"`
-		Constraints     []interface{} `json:"constraints"`
-		Container       interface{}   `json:"container"`
-		Cpus            float64       `json:"cpus"`
-		Dependencies    []interface{} `json:"dependencies"`
-		Disk            float64       `json:"disk"`
-		Env             struct{}      `json:"env"`
-		Executor        string        `json:"executor"`
-		Healthchecks    []interface{} `json:"healthChecks"`
-		ID              string        `json:"id"`
-		Instances       int           `json:"instances"`
-		Ports           []int         `json:"ports"`
-		Requireports    bool          `json:"requirePorts"`
-		Storeurls       []interface{} `json:"storeUrls"`
+		Args            []interface{}     `json:"args"`
+		Backofffactor   float64           `json:"backoffFactor"`
+		Backoffseconds  int               `json:"backoffSeconds"`
+		Cmd             string            `json:"cmd"`
+		Constraints     []interface{}     `json:"constraints"`
+		Container       interface{}       `json:"container"`
+		Cpus            float64           `json:"cpus"`
+		Dependencies    []interface{}     `json:"dependencies"`
+		Disk            float64           `json:"disk"`
+		Env             struct{}          `json:"env"`
+		Executor        string            `json:"executor"`
+		Healthchecks    []interface{}     `json:"healthChecks"`
+		ID              string            `json:"id"`
+		Instances       int               `json:"instances"`
+		Labels          map[string]string `json:"labels"`
+		Ports           []int             `json:"ports"`
+		Requireports    bool              `json:"requirePorts"`
+		Storeurls       []interface{}     `json:"storeUrls"`
 		Upgradestrategy struct {
 			Minimumhealthcapacity float64 `json:"minimumHealthCapacity"`
 		} `json:"upgradeStrategy"`
@@ -59,3 +107,196 @@ type AppTerminatedEvent struct {
 	Event
 	Appid string `json:"appId"`
 }
+
+//HealthCheck describes a Marathon health check definition as it is attached to health check events
+type HealthCheck struct {
+	Protocol               string `json:"protocol"`
+	Path                   string `json:"path"`
+	Portindex              int    `json:"portIndex"`
+	Graceperiodseconds     int    `json:"gracePeriodSeconds"`
+	Intervalseconds        int    `json:"intervalSeconds"`
+	Timeoutseconds         int    `json:"timeoutSeconds"`
+	Maxconsecutivefailures int    `json:"maxConsecutiveFailures"`
+}
+
+//AddHealthCheckEvent is fired when a health check is added to an app
+type AddHealthCheckEvent struct {
+	Event
+	Appid       string      `json:"appId"`
+	Healthcheck HealthCheck `json:"healthCheck"`
+}
+
+//RemoveHealthCheckEvent is fired when a health check is removed from an app
+type RemoveHealthCheckEvent struct {
+	Event
+	Appid       string      `json:"appId"`
+	Healthcheck HealthCheck `json:"healthCheck"`
+}
+
+//FailedHealthCheckEvent is fired when a health check of a task fails
+type FailedHealthCheckEvent struct {
+	Event
+	Appid       string      `json:"appId"`
+	Taskid      string      `json:"taskId"`
+	Healthcheck HealthCheck `json:"healthCheck"`
+}
+
+//HealthStatusChangedEvent is fired when a task becomes healthy or unhealthy
+type HealthStatusChangedEvent struct {
+	Event
+	Appid   string `json:"appId"`
+	Taskid  string `json:"taskId"`
+	Version string `json:"version"`
+	Alive   bool   `json:"alive"`
+}
+
+//GroupChangeSuccessEvent is fired when a group change was applied
+type GroupChangeSuccessEvent struct {
+	Event
+	Groupid string `json:"groupId"`
+	Version string `json:"version"`
+}
+
+//GroupChangeFailedEvent is fired when a group change could not be applied
+type GroupChangeFailedEvent struct {
+	Event
+	Groupid string `json:"groupId"`
+	Version string `json:"version"`
+	Reason  string `json:"reason"`
+}
+
+//DeploymentSuccessEvent is fired when a deployment finished successfully
+type DeploymentSuccessEvent struct {
+	Event
+	ID string `json:"id"`
+}
+
+//DeploymentFailedEvent is fired when a deployment failed
+type DeploymentFailedEvent struct {
+	Event
+	ID string `json:"id"`
+}
+
+//DeploymentGroup is the original or target group of a deployment plan
+type DeploymentGroup struct {
+	Apps         []json.RawMessage `json:"apps"`
+	Dependencies []interface{}     `json:"dependencies"`
+	Groups       []json.RawMessage `json:"groups"`
+	ID           string            `json:"id"`
+	Version      string            `json:"version"`
+}
+
+//DeploymentPlan describes the steps Marathon takes to get from the original to the target group
+type DeploymentPlan struct {
+	ID       string          `json:"id"`
+	Original DeploymentGroup `json:"original"`
+	Target   DeploymentGroup `json:"target"`
+	Steps    []struct {
+		Action string `json:"action"`
+		App    string `json:"app"`
+	} `json:"steps"`
+	Version string `json:"version"`
+}
+
+//DeploymentStep holds the actions of the currently executed step of a deployment plan
+type DeploymentStep struct {
+	Actions []struct {
+		Type string `json:"type"`
+		App  string `json:"app"`
+	} `json:"actions"`
+}
+
+//DeploymentInfoEvent is fired when a deployment plan starts
+type DeploymentInfoEvent struct {
+	Event
+	Plan        DeploymentPlan `json:"plan"`
+	Currentstep DeploymentStep `json:"currentStep"`
+}
+
+//DeploymentStepSuccessEvent is fired when a step of a deployment plan finished successfully
+type DeploymentStepSuccessEvent struct {
+	Event
+	Plan        DeploymentPlan `json:"plan"`
+	Currentstep DeploymentStep `json:"currentStep"`
+}
+
+//DeploymentStepFailureEvent is fired when a step of a deployment plan failed
+type DeploymentStepFailureEvent struct {
+	Event
+	Plan        DeploymentPlan `json:"plan"`
+	Currentstep DeploymentStep `json:"currentStep"`
+}
+
+//FrameworkMessageEvent is fired when an executor sends a message to Marathon
+type FrameworkMessageEvent struct {
+	Event
+	Slaveid    string `json:"slaveId"`
+	Executorid string `json:"executorId"`
+	Message    string `json:"message"`
+}
+
+//SubscribeEvent is fired when a new http callback subscriber is added
+type SubscribeEvent struct {
+	Event
+	Clientip    string `json:"clientIp"`
+	Callbackurl string `json:"callbackUrl"`
+}
+
+//UnsubscribeEvent is fired when a http callback subscriber is removed
+type UnsubscribeEvent struct {
+	Event
+	Clientip    string `json:"clientIp"`
+	Callbackurl string `json:"callbackUrl"`
+}
+
+//EventTypes maps the eventType field of a Marathon event to a constructor of its typed representation
+var EventTypes = map[string]func() interface{}{
+	"api_post_event":              func() interface{} { return &APIRequestEvent{} },
+	"status_update_event":         func() interface{} { return &StatusUpdateEvent{} },
+	"app_terminated_event":        func() interface{} { return &AppTerminatedEvent{} },
+	"add_health_check_event":      func() interface{} { return &AddHealthCheckEvent{} },
+	"remove_health_check_event":   func() interface{} { return &RemoveHealthCheckEvent{} },
+	"failed_health_check_event":   func() interface{} { return &FailedHealthCheckEvent{} },
+	"health_status_changed_event": func() interface{} { return &HealthStatusChangedEvent{} },
+	"group_change_success":        func() interface{} { return &GroupChangeSuccessEvent{} },
+	"group_change_failed":         func() interface{} { return &GroupChangeFailedEvent{} },
+	"deployment_success":          func() interface{} { return &DeploymentSuccessEvent{} },
+	"deployment_failed":           func() interface{} { return &DeploymentFailedEvent{} },
+	"deployment_info":             func() interface{} { return &DeploymentInfoEvent{} },
+	"deployment_step_success":     func() interface{} { return &DeploymentStepSuccessEvent{} },
+	"deployment_step_failure":     func() interface{} { return &DeploymentStepFailureEvent{} },
+	"framework_message_event":     func() interface{} { return &FrameworkMessageEvent{} },
+	"subscribe_event":             func() interface{} { return &SubscribeEvent{} },
+	"unsubscribe_event":           func() interface{} { return &UnsubscribeEvent{} },
+}
+
+//AppID returns the id of the app an event refers to, or an empty string for events not bound to a single app
+func AppID(event interface{}) string {
+	switch e := event.(type) {
+	case *APIRequestEvent:
+		return e.Appdefinition.ID
+	case *StatusUpdateEvent:
+		return e.Appid
+	case *AppTerminatedEvent:
+		return e.Appid
+	case *AddHealthCheckEvent:
+		return e.Appid
+	case *RemoveHealthCheckEvent:
+		return e.Appid
+	case *FailedHealthCheckEvent:
+		return e.Appid
+	case *HealthStatusChangedEvent:
+		return e.Appid
+	}
+	return ""
+}
+
+//ClusterOf returns the cluster an event came from, empty for the default cluster
+func ClusterOf(event interface{}) string {
+	if e, ok := event.(interface {
+		FromCluster() string
+	}); ok {
+		return e.FromCluster()
+	}
+	return ""
+}
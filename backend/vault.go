@@ -12,7 +12,9 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
@@ -23,38 +25,60 @@ import (
 
 //FIXME: this should be a member of the vault structure, but the current use of values instead of pointers
 //for methods makes it impossible. As long as this is not addressed, this variable will stay global.
-var sharedSecret map[string]chan string
+//The workers of the dispatcher and the secret server use it concurrently, so it is guarded by sharedSecretMutex.
+var (
+	sharedSecret      = make(map[string][]string) // tokens not fetched yet by app scoped to its cluster, oldest first
+	secretPublished   = make(chan struct{})       // closed and replaced whenever a token is published
+	sharedSecretMutex sync.Mutex
+)
+
+//secretWaitTimeout bounds how long an app waits for its token
+var secretWaitTimeout = 5 * time.Minute
 
 //due to plugin based architecture that has allows plugin to use a map[string]string to be used
 //as configuration in the standard howler config.yaml, we have to check for presence of mandatory
 //fields here manually
 func mandatoryConfigCheck(config map[string]string) {
-	if config["tokenTTL"] == "" {
-		glog.Errorf("TTL configuration is empty, please provide a valid one.\n")
+	if err := mandatoryConfig(config); err != nil {
+		glog.Errorf("%s, please provide a valid one.\n", err)
 		os.Exit(1)
 	}
-	if config["vaultURI"] == "" {
-		glog.Errorf("vaultURI is empty, please provide a valid one.\n")
-		os.Exit(1)
-	}
-	if config["vaultToken"] == "" {
-		glog.Errorf("vaultToken is empty, please provide a valid one.\n")
-		os.Exit(1)
+}
+
+//mandatoryConfig returns an error for the first mandatory field which is empty
+func mandatoryConfig(config map[string]string) error {
+	for _, field := range []string{"tokenTTL", "vaultURI", "vaultToken"} {
+		if config[field] == "" {
+			return fmt.Errorf("%s is empty", field)
+		}
 	}
+	return nil
 }
 
 //Vault is the basic type of the plugin
 type Vault struct {
 	config map[string]string
 	name   string
+	server *secretServer
 }
 
-//getSecret is the handler to read the secret from a channel based on the app id
+//secretServer is the server distributing the cubbyhole tokens, shared by all copies of the plugin
+type secretServer struct {
+	mutex  sync.Mutex
+	server *http.Server
+	closed bool
+}
+
+//getSecret is the handler to read the secret based on the app id, of the cluster for /clusters/:cluster/secret/:appID
 func (v *Vault) getSecret(ginCtx *gin.Context) {
 	appID := ginCtx.Params.ByName("appID")
 	glog.Infof("App %s waiting to read cubbyhole token.\n", appID)
-	createChannelIfNotExistent(appID)
-	value := <-sharedSecret[appID]
+	value, ok := takeSecret(secretKey(ginCtx.Params.ByName("cluster"), appID), secretWaitTimeout)
+	if !ok {
+		glog.Warningf("No token for app %s within %s\n", appID, secretWaitTimeout)
+		ginCtx.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no token for app %s", appID)})
+		return
+	}
 	glog.Infof("Token for app %s will be sent\n", appID)
 	ginCtx.JSON(http.StatusOK, gin.H{"secret": value})
 }
@@ -79,54 +103,136 @@ func (v *Vault) startServer() error {
 	tlsConfig.Rand = rand.Reader
 
 	router.GET("/secret/:appID", v.getSecret)
+	router.GET("/clusters/:cluster/secret/:appID", v.getSecret)
 	serve := &http.Server{
 		Addr:      fmt.Sprintf(":%s", v.config["serverPort"]),
 		Handler:   router,
 		TLSConfig: &tlsConfig,
 	}
+	v.server.mutex.Lock()
+	if v.server.closed {
+		v.server.mutex.Unlock()
+		return nil
+	}
+	v.server.server = serve
+	v.server.mutex.Unlock()
 	err = serve.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
 	if err != nil {
 		glog.Errorf("Cannot start server for Cubbyhole tokens distribution\n")
 	}
 	return err
 }
 
+//Close stops the server distributing the cubbyhole tokens. Apps still waiting for their token are disconnected.
+func (v *Vault) Close() error {
+	v.server.mutex.Lock()
+	defer v.server.mutex.Unlock()
+	v.server.closed = true
+	if v.server.server == nil {
+		return nil
+	}
+	return v.server.server.Close()
+}
+
 //Register is used to register the vault plugin in howler
 func (v *Vault) Register() error { //FIXME: error should always be the last error type
 	v.name = "Vault"
 	config := conf.New().Backends["vault"]
 	mandatoryConfigCheck(config)
 	v.config = config
-	sharedSecret = make(map[string]chan string)
+	v.server = &secretServer{}
 	go v.startServer()
 	return nil
 }
 
-//pushValueToChannel pushes a value to a channel. It invokes "make" if this was not done before
-func createChannelIfNotExistent(appID string) {
-	if sharedSecret[appID] == nil {
-		sharedSecret[appID] = make(chan string, 1)
+//inCluster returns a copy of the plugin with the current config for events of the cluster, p.e. another
+//vaultURI. The secret server keeps running with the config it was started with.
+func (v *Vault) inCluster(cluster string) *Vault {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	clustered := *v
+	if cluster != "" {
+		clustered.config = conf.New().BackendConfig("vault", cluster)
+	}
+	return &clustered
+}
+
+//CheckConfig requires the mandatory fields for every cluster
+func (v *Vault) CheckConfig(config *conf.Config) error {
+	return checkClusters(config, "vault", mandatoryConfig)
+}
+
+//UseConfig applies the reloaded config to the events handled from now on, p.e. another tokenTTL
+func (v *Vault) UseConfig(config *conf.Config) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	v.config = config.BackendConfig("vault", "")
+}
+
+//secretKey scopes the app id to the cluster, apps with the same id in different clusters get different tokens
+func secretKey(cluster string, appID string) string {
+	if cluster == "" {
+		return appID
+	}
+	return cluster + "|" + appID
+}
+
+//publishSecret hands the token to the app without blocking the worker of the dispatcher. Every task of the
+//app gets a token of its own, so tokens are kept until they are fetched, in the order they were created.
+func publishSecret(appID string, token string) {
+	sharedSecretMutex.Lock()
+	defer sharedSecretMutex.Unlock()
+	sharedSecret[appID] = append(sharedSecret[appID], token)
+	close(secretPublished)
+	secretPublished = make(chan struct{})
+}
+
+//takeSecret returns the oldest token of the app not fetched yet, waiting up to timeout for one to be published
+func takeSecret(appID string, timeout time.Duration) (string, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		sharedSecretMutex.Lock()
+		if tokens := sharedSecret[appID]; len(tokens) > 0 {
+			if len(tokens) == 1 {
+				delete(sharedSecret, appID)
+			} else {
+				sharedSecret[appID] = tokens[1:]
+			}
+			sharedSecretMutex.Unlock()
+			return tokens[0], true
+		}
+		published := secretPublished
+		sharedSecretMutex.Unlock()
+		select {
+		case <-published:
+		case <-timer.C:
+			return "", false
+		}
 	}
 }
 
 // HandleUpdate adds or removes container to loadbalancer pool
-func (v *Vault) HandleUpdate(e StatusUpdateEvent) {
+func (v *Vault) HandleUpdate(e StatusUpdateEvent) error {
 	switch e.Taskstatus {
 	case "TASK_RUNNING":
 		glog.Infof("Task is running, creating secrets\n")
-		v.createSecrets(e)
+		return v.inCluster(e.Cluster).createSecrets(e)
 	}
+	return nil
 }
 
-func (v *Vault) createSecrets(e StatusUpdateEvent) {
+func (v *Vault) createSecrets(e StatusUpdateEvent) error {
 	vb := vaultBackend{}
 	vb.appID = strings.TrimPrefix(e.Appid, "/") //Marathon specific, needed to remove initial "/" char
-	createChannelIfNotExistent(vb.appID)
 	//authenticate against vault using Th howler token
 	err := vb.vaultAuthenticate(v.config["vaultURI"], v.config["vaultToken"])
 	if err != nil {
 		glog.Errorf("Cannot authenticate with Vault.\n")
-		return
+		return err
 	}
 
 	ttl := v.config["tokenTTL"]
@@ -134,25 +240,34 @@ func (v *Vault) createSecrets(e StatusUpdateEvent) {
 	cubbyhole, err := vb.createToken(ttl)
 	if err != nil {
 		glog.Errorf("Cannot generate cubbyhole token.\n")
-		return
+		return err
 	}
 
-	teamName := vb.getTeamName(v.config["marathonEndpoint"], v.config["marathonUsername"], v.config["marathonPassword"])
-	if teamName == "" {
+	// the team label comes with the event if the dispatcher knows the app, Marathon is only asked otherwise
+	var teamName string
+	if e.App != nil {
+		teamName = e.App.Labels["team"]
+		if teamName == "" {
+			err = Permanent(fmt.Errorf("app %s has no team label", vb.appID))
+		}
+	} else {
+		teamName, err = vb.getTeamName(v.config["marathonEndpoint"], v.config["marathonUsername"], v.config["marathonPassword"])
+	}
+	if err != nil {
 		glog.Errorf("Cannot get team name\n")
-		return
+		return err
 	}
 
 	policy, err := vb.createNewPolicy(v.config["teamPolicyFile"], teamName)
 	if err != nil {
 		glog.Errorf("Cannot create new Policy\n")
-		return
+		return Permanent(err)
 	}
 
 	err = vb.usePolicy(policy)
 	if err != nil {
 		glog.Errorf("Cannot use generated policy:\n")
-		return
+		return err
 	}
 
 	//glog.Infof("created cubbyhole: " + cubbyhole) //TODO: uncomment line for debugging. Generated tokens must not be written to files.
@@ -160,35 +275,60 @@ func (v *Vault) createSecrets(e StatusUpdateEvent) {
 	secretToken, err := vb.createToken(ttl)
 	if err != nil {
 		glog.Errorf("Cannot generate secret token\n")
-		return
+		return err
 	}
 	//glog.Infof("created secret: " + secretToken) //TODO: uncomment line for debugging. Generated tokens must not be written to files.
 	//authenticate with T1 => create a new client with that token
 	err = vb.vaultAuthenticate(v.config["vaultURI"], cubbyhole) //after that "v" is fresh and ready to auth with cubbhyhole
 	if err != nil {
 		glog.Errorf("Cannot authenticate with cubbyhole token\n")
-		return
+		return err
 	}
 	//store secret T2 protected by cubbyhole token
 	err = vb.storeInCubbyhole(secretToken)
 	if err != nil {
 		glog.Errorf("Error while storing in cubbyhole\n")
-		return
+		return err
 	}
 	//send token T1 in the channel (unlocks any possible waiting thread)
-	sharedSecret[vb.appID] <- cubbyhole
+	publishSecret(secretKey(e.Cluster, vb.appID), cubbyhole)
 	glog.Infof("Tokens creation done for %s", vb.appID)
 	//TODO discard previous authentication
+	return nil
+}
+
+//CheckHealth fails if Vault is sealed or does not accept Howler's token
+func (v *Vault) CheckHealth() error {
+	v = v.inCluster("")
+	config := api.DefaultConfig()
+	config.Address = v.config["vaultURI"]
+	config.HttpClient.Timeout = healthTimeout
+	client, err := api.NewClient(config)
+	if err != nil {
+		return err
+	}
+	client.SetToken(v.config["vaultToken"])
+	status, err := client.Sys().SealStatus()
+	if err != nil {
+		return fmt.Errorf("unable to get seal status: %s", err)
+	}
+	if status.Sealed {
+		return fmt.Errorf("vault is sealed")
+	}
+	if _, err := client.Auth().Token().LookupSelf(); err != nil {
+		return fmt.Errorf("invalid vault token: %s", err)
+	}
+	return nil
 }
 
 //HandleCreate does nothing in this case as we're not dealing with Create events
-func (v *Vault) HandleCreate(e APIRequestEvent) {
-	return //No need of actions in case of create requests
+func (v *Vault) HandleCreate(e APIRequestEvent) error {
+	return nil //No need of actions in case of create requests
 }
 
 //HandleDestroy does nothing in this case as we're not dealing with Delete events
-func (v *Vault) HandleDestroy(e AppTerminatedEvent) {
-	return //No need of actions in case of destroy requests
+func (v *Vault) HandleDestroy(e AppTerminatedEvent) error {
+	return nil //No need of actions in case of destroy requests
 }
 
 //Name returns the backend service name
@@ -303,13 +443,13 @@ func (vb *vaultBackend) usePolicy(template string) error {
 
 //calls the marathon API back to get the team name
 //assumes that the team is saved in the labels
-func (vb *vaultBackend) getTeamName(endpoint string, username string, password string) string {
+func (vb *vaultBackend) getTeamName(endpoint string, username string, password string) (string, error) {
 	//the call is just a plain rest call parsing for a specific field, no need to use the marathon go api here.
 	client := &http.Client{}
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", endpoint, vb.appID), nil)
 	if err != nil {
 		glog.Errorf("Cannot build request: %s\n", err.Error())
-		return ""
+		return "", Permanent(err)
 	}
 	if username != "" && password != "" {
 		req.SetBasicAuth(username, password)
@@ -317,22 +457,29 @@ func (vb *vaultBackend) getTeamName(endpoint string, username string, password s
 	res, err := client.Do(req)
 	if err != nil {
 		glog.Errorf("Cannot GET app info from Marathon: %s\n", err.Error())
-		defer res.Body.Close()
+		return "", err
+	}
+	defer res.Body.Close()
+	if err := responseError(res.StatusCode, fmt.Sprintf("getting app %s from Marathon", vb.appID)); err != nil {
+		return "", err
 	}
 	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
 
-	var data map[string]interface{}
+	var data struct {
+		App struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"app"`
+	}
 	err = json.Unmarshal(body, &data)
 	if err != nil {
 		glog.Errorf("Cannot unmarshal data: %s\n", err.Error())
-		return ""
+		return "", Permanent(err)
 	}
-
-	app := data["app"].(map[string]interface{})
-
-	labels := app["labels"].(map[string]interface{})
-	if labels["team"] != nil {
-		return labels["team"].(string)
+	if data.App.Labels["team"] == "" {
+		return "", Permanent(fmt.Errorf("app %s has no team label", vb.appID))
 	}
-	return ""
+	return data.App.Labels["team"], nil
 }
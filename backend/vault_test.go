@@ -3,6 +3,9 @@ package backend
 import (
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/conf"
 )
 
 func Test_isStringValid(t *testing.T) {
@@ -47,3 +50,79 @@ func Test_buildTemplate(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func Test_VaultCheckConfig(t *testing.T) {
+	vault := map[string]string{"tokenTTL": "1h", "vaultURI": "https://vault:8200", "vaultToken": "token"}
+	config := &conf.Config{
+		Backends: map[string]map[string]string{"vault": vault},
+		Clusters: map[string]conf.Cluster{"eu-west": {Backends: map[string]map[string]string{"vault": {"vaultURI": "https://eu-vault:8200"}}}},
+	}
+	v := &Vault{}
+	if err := v.CheckConfig(config); err != nil {
+		fmt.Printf("Expected the cluster to inherit the mandatory fields, got: %s\n", err)
+		t.FailNow()
+	}
+	config.Clusters["eu-west"].Backends["vault"]["vaultToken"] = ""
+	if err := v.CheckConfig(config); err == nil {
+		fmt.Println("Expected an empty vaultToken of a cluster to be refused")
+		t.FailNow()
+	}
+	v.UseConfig(config)
+	if v.inCluster("").config["tokenTTL"] != "1h" {
+		fmt.Printf("Expected the reloaded config to be used, got: %v\n", v.config)
+		t.FailNow()
+	}
+}
+
+func Test_publishSecret(t *testing.T) {
+	// an app starting three instances gets three tokens, none of them is lost
+	done := make(chan struct{})
+	go func() {
+		for _, token := range []string{"first", "second", "third"} {
+			publishSecret("my-app", token)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		fmt.Println("Expected publishing tokens not to block until the app fetched them")
+		t.FailNow()
+	}
+	for _, expected := range []string{"first", "second", "third"} {
+		if token, ok := takeSecret("my-app", time.Second); !ok || token != expected {
+			fmt.Printf("Expected token %s to be delivered, got: %s\n", expected, token)
+			t.FailNow()
+		}
+	}
+	if token, ok := takeSecret("my-app", 10*time.Millisecond); ok {
+		fmt.Printf("Expected no further token, got: %s\n", token)
+		t.FailNow()
+	}
+
+	// an app waiting for its token gets it once it is published
+	fetched := make(chan string)
+	go func() {
+		token, _ := takeSecret("my-app", time.Second)
+		fetched <- token
+	}()
+	time.Sleep(10 * time.Millisecond)
+	publishSecret("other-app", "other")
+	publishSecret("my-app", "late")
+	if token := <-fetched; token != "late" {
+		fmt.Printf("Expected the waiting app to get its token, got: %s\n", token)
+		t.FailNow()
+	}
+}
+
+func Test_secretKey(t *testing.T) {
+	publishSecret(secretKey("eu-west", "clustered-app"), "eu-west")
+	if token, ok := takeSecret(secretKey("", "clustered-app"), 10*time.Millisecond); ok {
+		fmt.Printf("Expected the token of another cluster not to be handed out, got: %s\n", token)
+		t.FailNow()
+	}
+	if token, ok := takeSecret(secretKey("eu-west", "clustered-app"), time.Second); !ok || token != "eu-west" {
+		fmt.Printf("Expected the token of the cluster, got: %s\n", token)
+		t.FailNow()
+	}
+}
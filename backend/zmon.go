@@ -9,6 +9,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/zalando-techmonkeys/howler/conf"
+	"github.com/zalando-techmonkeys/howler/state"
 	"gopkg.in/jmcvetta/napping.v3"
 )
 
@@ -19,7 +20,9 @@ type Zmon struct {
 }
 
 // ZmonEntity represents an entity in ZMON
-// @TODO: entity.ApplicationID should be postfixed with team name which owns the service, for now it's just "[techmonkeys]"
+// entity.ApplicationID is postfixed with the team label of the app, "[techmonkeys]" if it is unknown
+// entity.Cluster is the Marathon cluster of the task, empty for the default one
+// entity.CreatedBy is the owner of the entities Howler creates, only those are deleted by Reconcile
 type ZmonEntity struct {
 	Type           string         `json:"type"`
 	ID             string         `json:"id"`
@@ -27,8 +30,13 @@ type ZmonEntity struct {
 	Host           string         `json:"host"`
 	Ports          map[string]int `json:"ports"`
 	DataCenterCode string         `json:"data_center_code"`
+	Cluster        string         `json:"cluster,omitempty"`
+	CreatedBy      string         `json:"created_by,omitempty"`
 }
 
+//defaultZmonOwner marks the entities Howler creates, if no owner is configured
+const defaultZmonOwner = "howler"
+
 //Name returns Zmon backend name
 func (be *Zmon) Name() string {
 	return be.name
@@ -43,24 +51,68 @@ func (be *Zmon) Register() error {
 	return nil
 }
 
+//inCluster returns a copy of the backend with the current config for events of the cluster
+func (be *Zmon) inCluster(cluster string) *Zmon {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	clustered := *be
+	if cluster != "" {
+		clustered.config = conf.New().BackendConfig("zmon", cluster)
+	}
+	return &clustered
+}
+
+//CheckConfig requires the entity service, if Zmon is configured for a cluster
+func (be *Zmon) CheckConfig(config *conf.Config) error {
+	return checkClusters(config, "zmon", func(zmon map[string]string) error {
+		if len(zmon) > 0 && zmon["entityService"] == "" {
+			return fmt.Errorf("entityService is empty")
+		}
+		return nil
+	})
+}
+
+//UseConfig applies the reloaded config to the events handled from now on
+func (be *Zmon) UseConfig(config *conf.Config) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	be.config = config.BackendConfig("zmon", "")
+}
+
+//CheckHealth pings the entity service
+func (be *Zmon) CheckHealth() error {
+	be = be.inCluster("")
+	if be.config["entityService"] == "" {
+		return fmt.Errorf("entityService is empty")
+	}
+	req, err := http.NewRequest("GET", be.config["entityService"], nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(be.config["user"], be.config["password"])
+	return ping(req)
+}
+
 //HandleCreate reaps API request events from Marathon
-func (be *Zmon) HandleCreate(e APIRequestEvent) {
+func (be *Zmon) HandleCreate(e APIRequestEvent) error {
 	//TODO write implementation
+	return nil
 }
 
 //HandleDestroy reaps API terminated events from Marathon
-func (be *Zmon) HandleDestroy(e AppTerminatedEvent) {
+func (be *Zmon) HandleDestroy(e AppTerminatedEvent) error {
 	//TODO write implementation
+	return nil
 }
 
 //HandleUpdate reaps update events from Marathon
-func (be *Zmon) HandleUpdate(e StatusUpdateEvent) {
+func (be *Zmon) HandleUpdate(e StatusUpdateEvent) error {
 	if e.Taskstatus == "TASK_RUNNING" {
-		be.insertEntity(e)
+		return be.inCluster(e.Cluster).insertEntity(e)
 	} else if e.Taskstatus == "TASK_KILLED" || e.Taskstatus == "TASK_LOST" { //TODO should we add more Taskstatus for when a task is killed?
-		be.deleteEntity(e)
+		return be.inCluster(e.Cluster).deleteEntity(e)
 	}
-	return
+	return nil
 }
 
 //deleteEntity deletes Zmon entities
@@ -75,11 +127,11 @@ func (be *Zmon) deleteEntity(e StatusUpdateEvent) error {
 	session := be.getSession()
 	response, err = session.Delete(deleteURL, &p, nil, nil)
 	if err != nil {
-		glog.Errorf(fmt.Sprintf("unable to delete zmonEntity with ID '%s': %s", e.Taskid, err))
+		glog.Errorf("unable to delete zmonEntity with ID '%s': %s", e.Taskid, err)
 		return err
 	}
 	glog.Infof("DELETE response (%d): %s", response.Status(), response.RawText())
-	return nil
+	return responseError(response.Status(), fmt.Sprintf("deleting zmonEntity with ID '%s'", e.Taskid))
 }
 
 //insertEntity creates/updates Zmon entities
@@ -87,9 +139,13 @@ func (be *Zmon) insertEntity(e StatusUpdateEvent) error {
 	var err error
 	var response *napping.Response
 
-	entity := &ZmonEntity{Type: "service"}
+	entity := &ZmonEntity{Type: "service", Cluster: e.Cluster, CreatedBy: be.owner()}
 	entity.ID = e.Taskid
-	entity.ApplicationID = e.Appid + "[techmonkeys]"
+	team := "techmonkeys"
+	if e.App != nil && e.App.Labels["team"] != "" {
+		team = e.App.Labels["team"]
+	}
+	entity.ApplicationID = fmt.Sprintf("%s[%s]", e.Appid, team)
 	datacenter := strings.Split(e.Host, "-")[0]
 	entity.DataCenterCode = strings.ToUpper(datacenter)
 	entity.Host = e.Host
@@ -107,7 +163,16 @@ func (be *Zmon) insertEntity(e StatusUpdateEvent) error {
 		return err
 	}
 	glog.Infof("PUT response (%d): %s", response.Status(), response.RawText())
-	return nil
+	return responseError(response.Status(), fmt.Sprintf("inserting zmonEntity with ID '%s'", entity.ID))
+}
+
+//owner returns the owner the entities are marked with, several Howler deployments feeding the same
+//ZMON need an owner each
+func (be *Zmon) owner() string {
+	if be.config["owner"] != "" {
+		return be.config["owner"]
+	}
+	return defaultZmonOwner
 }
 
 //getSession initiates a Zmon session
@@ -120,3 +185,57 @@ func (be *Zmon) getSession() napping.Session {
 	return s
 
 }
+
+//Reconcile inserts the entities of routed running tasks missing in ZMON and deletes the entities of tasks
+//which are gone. Only service entities Howler created are deleted, entities created by hand, by other owners
+//or of tasks which are running, but excluded by routing, are left alone. The snapshots are the state of the
+//default cluster, entities of other clusters are left alone as well.
+func (be *Zmon) Reconcile(routed state.Snapshot, all state.Snapshot) ([]Change, error) {
+	be = be.inCluster("")
+	var entities []ZmonEntity
+	session := be.getSession()
+	params := napping.Params{"query": `{"type": "service"}`}.AsUrlValues()
+	response, err := session.Get(fmt.Sprintf("%s/", be.config["entityService"]), &params, &entities, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := responseError(response.Status(), "listing zmonEntities"); err != nil {
+		return nil, err
+	}
+
+	running := make(map[string]bool)
+	for _, task := range all.Tasks {
+		running[task.ID] = task.Status == "TASK_RUNNING"
+	}
+	var changes []Change
+	var firstErr error
+	existing := make(map[string]bool)
+	for _, entity := range entities {
+		existing[entity.ID] = true
+		if entity.CreatedBy != be.owner() || entity.Cluster != "" || running[entity.ID] {
+			continue
+		}
+		if err := be.deleteEntity(StatusUpdateEvent{Taskid: entity.ID}); err != nil {
+			glog.Errorf("unable to delete stale zmonEntity '%s': %s", entity.ID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		changes = append(changes, Change{Action: ChangeRemoved, Resource: "entity " + entity.ID})
+	}
+	for _, task := range routed.Tasks {
+		if task.Status != "TASK_RUNNING" || existing[task.ID] {
+			continue
+		}
+		if err := be.insertEntity(taskEvent(task)); err != nil {
+			glog.Errorf("unable to insert missing zmonEntity '%s': %s", task.ID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		changes = append(changes, Change{Action: ChangeAdded, Resource: "entity " + task.ID})
+	}
+	return changes, firstErr
+}
@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/zalando-techmonkeys/howler/state"
+)
+
+//entityStandIn serves ZMON's entity service
+type entityStandIn struct {
+	sync.Mutex
+	entities map[string]ZmonEntity
+}
+
+func (m *entityStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+	switch r.Method {
+	case "GET":
+		entities := []ZmonEntity{}
+		for _, entity := range m.entities {
+			entities = append(entities, entity)
+		}
+		json.NewEncoder(w).Encode(entities)
+	case "PUT":
+		var entity ZmonEntity
+		json.NewDecoder(r.Body).Decode(&entity)
+		m.entities[entity.ID] = entity
+	case "DELETE":
+		delete(m.entities, r.URL.Query().Get("id"))
+	}
+}
+
+func Test_ZmonReconcile(t *testing.T) {
+	standIn := &entityStandIn{entities: map[string]ZmonEntity{
+		"stale":     {ID: "stale", Type: "service", ApplicationID: "/my-app[techmonkeys]", CreatedBy: "howler"},
+		"running":   {ID: "running", Type: "service", ApplicationID: "/my-app[techmonkeys]", CreatedBy: "howler"},
+		"foreign":   {ID: "foreign", Type: "service", ApplicationID: "some-service"},
+		"manual":    {ID: "manual", Type: "service", ApplicationID: "/my-app[techmonkeys]"},
+		"other":     {ID: "other", Type: "service", ApplicationID: "/my-app[techmonkeys]", CreatedBy: "other-howler"},
+		"excluded":  {ID: "excluded", Type: "service", ApplicationID: "/internal/db[techmonkeys]", CreatedBy: "howler"},
+		"clustered": {ID: "clustered", Type: "service", ApplicationID: "/my-app[techmonkeys]", Cluster: "eu-west", CreatedBy: "howler"},
+	}}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	be := &Zmon{name: "Zmon", config: map[string]string{"entityService": server.URL}}
+
+	routed := state.Snapshot{Tasks: []state.Task{
+		{ID: "running", AppID: "/my-app", Host: "dc1-node1", Status: "TASK_RUNNING"},
+		{ID: "missing", AppID: "/my-app", Host: "dc1-node2", Status: "TASK_RUNNING", Ports: []int{31000}},
+		{ID: "staging", AppID: "/my-app", Host: "dc1-node3", Status: "TASK_STAGING"},
+	}}
+	// routing rules exclude /internal/db from Zmon, its entity must survive
+	all := state.Snapshot{Tasks: append([]state.Task{
+		{ID: "excluded", AppID: "/internal/db", Host: "dc1-node4", Status: "TASK_RUNNING"},
+		{ID: "unrouted", AppID: "/internal/db", Host: "dc1-node5", Status: "TASK_RUNNING"},
+	}, routed.Tasks...)}
+	changes, err := be.Reconcile(routed, all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{{Action: ChangeRemoved, Resource: "entity stale"}, {Action: ChangeAdded, Resource: "entity missing"}}
+	if fmt.Sprint(changes) != fmt.Sprint(expected) {
+		fmt.Printf("Expected changes %v, got: %v\n", expected, changes)
+		t.FailNow()
+	}
+	var ids []string
+	for id := range standIn.entities {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if fmt.Sprint(ids) != "[clustered excluded foreign manual missing other running]" {
+		fmt.Printf("Unexpected entities after reconciliation: %v\n", ids)
+		t.FailNow()
+	}
+	if inserted := standIn.entities["missing"]; inserted.DataCenterCode != "DC1" || inserted.CreatedBy != "howler" {
+		fmt.Printf("Unexpected inserted entity: %+v\n", inserted)
+		t.FailNow()
+	}
+}
+
+func Test_ZmonCheckHealth(t *testing.T) {
+	server := httptest.NewServer(&entityStandIn{entities: map[string]ZmonEntity{}})
+	be := &Zmon{name: "Zmon", config: map[string]string{"entityService": server.URL}}
+	if err := be.CheckHealth(); err != nil {
+		fmt.Printf("Expected the entity service to be up, got: %s\n", err)
+		t.FailNow()
+	}
+	server.Close()
+	if err := be.CheckHealth(); err == nil {
+		fmt.Println("Expected an unreachable entity service to fail the health check")
+		t.FailNow()
+	}
+}
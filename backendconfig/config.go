@@ -5,13 +5,18 @@ import (
 	"github.com/zalando-techmonkeys/howler/backend"
 )
 
-// RegisteredBackends inherits backend interface
-var RegisteredBackends []backend.Backend
+// RegisteredBackends inherits backend interface, every one implements backend.Backend or backend.ReportingBackend
+var RegisteredBackends []backend.Plugin
 
 // RegisterBackends register every backend
-func RegisterBackends(enabledBackends []backend.Backend) []backend.Backend {
-	var backends []backend.Backend
+func RegisterBackends(enabledBackends []backend.Plugin) []backend.Plugin {
+	var backends []backend.Plugin
 	for _, backendInstance := range enabledBackends {
+		switch backendInstance.(type) {
+		case backend.Backend, backend.ReportingBackend:
+		default:
+			glog.Fatalf("backend %s implements neither backend.Backend nor backend.ReportingBackend", backendInstance.Name())
+		}
 		err := backendInstance.Register()
 		if err != nil {
 			glog.Fatalf("unable to register backend %s", backendInstance)
@@ -10,6 +10,6 @@ import (
 
 func init() {
 	fmt.Printf("------- REGISTERED DUMMY BACKEND CONFIG -------\n")
-	enabledBackends := []backend.Backend{&backend.DummyBackend{}}
+	enabledBackends := []backend.Plugin{&backend.DummyBackend{}}
 	RegisteredBackends = RegisterBackends(enabledBackends)
 }
@@ -5,6 +5,9 @@ package conf
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -13,20 +16,39 @@ import (
 
 // Config provides the base fields to start Howler
 type Config struct {
-	DebugEnabled     bool
-	Oauth2Enabled    bool //true if authentication is enabled
-	AuthURL          string
-	TokenURL         string
-	TLSCertfilePath  string
-	TLSKeyfilePath   string
-	LogFlushInterval time.Duration
-	Port             int
-	AuthorizedUsers  []AccessTuple
-	Backends         map[string]map[string]string
-	PrintVersion     bool
-	Version          string
-	BuildStamp       string
-	GitHash          string
+	DebugEnabled      bool
+	Oauth2Enabled     bool //true if authentication is enabled
+	AuthURL           string
+	TokenURL          string
+	TLSCertfilePath   string
+	TLSKeyfilePath    string
+	ClientCAFile      string   //CA bundle to verify client certificates on the event and admin routes, disabled if empty
+	AllowedClients    []string //subject common names or SANs of the client certificates allowed, any verified one if empty
+	LogFlushInterval  time.Duration
+	Port              int
+	AuthorizedUsers   []AccessTuple
+	AdminToken        string //bearer token for the admin API if OAuth2 is disabled
+	Callback          Callback
+	Backends          map[string]map[string]string
+	EventSource       string //"callback" (default) or "sse" to consume Marathon's event stream
+	Marathon          Marathon
+	Clusters          map[string]Cluster //further Marathon clusters, by the name their events are tagged with
+	JournalDir        string             //directory of the event journal, disabled if empty
+	JournalSegment    int64              //size of a journal segment in bytes
+	DeadLetterDir     string             //directory of the dead letters, kept in memory only if empty
+	BackendStateFile  string             //file keeping paused and disabled backends across restarts, kept in memory only if empty
+	ReconcileInterval int                //in seconds, backends are reconciled against Marathon periodically, 0 disables it
+	DedupWindow       int                //in seconds, events repeating a transition within the window are dropped, 0 disables it
+	ShutdownTimeout   int                //in seconds, bounds the shutdown including the backends handling the accepted events, 30 by default
+	CriticalBackends  []string           //backends whose failed health check fails /health, all if empty
+	Queues            map[string]Queue
+	Retries           map[string]Retry
+	Routes            map[string][]Route
+	Election          Election
+	PrintVersion      bool
+	Version           string
+	BuildStamp        string
+	GitHash           string
 }
 
 // AccessTuple provides fields verifying users
@@ -36,6 +58,111 @@ type AccessTuple struct {
 	Cn    string
 }
 
+// Marathon provides the fields to connect to the Marathon API
+type Marathon struct {
+	Endpoint           string //base URL, p.e. http://localhost:8080
+	Username           string
+	Password           string
+	CAFile             string //CA bundle to verify Marathon's certificate
+	InsecureSkipVerify bool
+	CallbackURL        string //if set, Howler registers this URL as event subscriber
+	SubscriptionCheck  int    //interval in seconds to verify the event subscription
+	AppCacheTTL        int    //seconds app definitions attached to events are cached
+	RequestTimeout     int    //seconds a REST request against Marathon may take, the event stream is not bounded
+}
+
+// Election provides the fields to run several Howler instances, of which only the leader dispatches events
+type Election struct {
+	Lock string //file or consul, leader election is disabled if empty
+	Path string //lock file of the file lock
+	URL  string //Consul agent of the consul lock, p.e. http://localhost:8500
+	Key  string //Consul key of the consul lock
+	ID   string //name of this instance, defaults to host:port
+	TTL  int    //in seconds, a leader which did not renew the lock within the ttl is replaced
+}
+
+// Callback provides the fields to verify the senders of events. The source address must be allowed,
+// and if a secret or token is configured, the body must be signed or the token passed.
+type Callback struct {
+	Secret     string   //shared secret, the body must be signed with its HMAC-SHA256 in the signature header
+	Header     string   //signature header, X-Howler-Signature by default
+	Token      string   //shared token, alternatively passed as token query parameter of the callback URL
+	AllowedIPs []string //addresses or CIDR ranges events may be sent from
+}
+
+// Cluster provides the fields of a further Marathon cluster. Its backend configs only hold the keys
+// differing from the default cluster, p.e. another loadbalancer list for Baboon.
+type Cluster struct {
+	Marathon Marathon
+	Backends map[string]map[string]string
+}
+
+// Queue provides the fields to size the queue of a backend
+type Queue struct {
+	Size     int    //number of events waiting for the backend
+	Workers  int    //number of events handled concurrently
+	Overflow string //block (default), drop-oldest or reject
+}
+
+// Retry provides the fields to retry failed events of a backend
+type Retry struct {
+	MaxAttempts int //including the first attempt
+	Backoff     int //delay before the first retry in milliseconds, doubled for every further retry
+	MaxBackoff  int //upper bound of the delay in milliseconds
+}
+
+// Route provides the fields to match the events a backend receives, empty fields match all events
+type Route struct {
+	EventTypes []string          //p.e. status_update_event
+	AppID      string            //glob, p.e. /public/*, a trailing /* matches the group and its subgroups
+	AppIDRegex string            //regular expression, p.e. ^/public/
+	TaskStatus []string          //p.e. TASK_RUNNING
+	Host       string            //glob, p.e. *.example.org
+	Labels     map[string]string //labels the app definition must have
+}
+
+//MarathonSettings returns the Marathon connection settings. If no marathon block is
+//configured, the marathonEndpoint and credentials of the backend configs are used.
+func (c *Config) MarathonSettings() Marathon {
+	settings := c.Marathon
+	if settings.Endpoint != "" {
+		return settings
+	}
+	var names []string
+	for name := range c.Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		backend := c.Backends[name]
+		if backend["marathonEndpoint"] == "" {
+			continue
+		}
+		// backends point to the apps resource, p.e. http://localhost:8080/v2/apps
+		settings.Endpoint = strings.TrimSuffix(strings.TrimRight(backend["marathonEndpoint"], "/"), "/v2/apps")
+		settings.Username = backend["marathonUsername"]
+		settings.Password = backend["marathonPassword"]
+		break
+	}
+	return settings
+}
+
+//BackendConfig returns the config of the backend for events of the cluster, the cluster's
+//overrides merged into the default config. An empty cluster returns the default config.
+func (c *Config) BackendConfig(name string, cluster string) map[string]string {
+	if cluster == "" {
+		return c.Backends[name]
+	}
+	config := make(map[string]string)
+	for key, value := range c.Backends[name] {
+		config[key] = value
+	}
+	for key, value := range c.Clusters[cluster].Backends[name] {
+		config[key] = value
+	}
+	return config
+}
+
 //ConfigError creates a struct just for future usage
 type ConfigError struct {
 	Message string
@@ -44,8 +171,13 @@ type ConfigError struct {
 //conf shares state for configuration
 var conf *Config
 
+//confMutex guards conf, which is replaced when the configuration is reloaded
+var confMutex sync.Mutex
+
 //New gets the loaded configuration
 func New() *Config {
+	confMutex.Lock()
+	defer confMutex.Unlock()
 	var err *ConfigError
 	if conf == nil {
 		conf, err = configInit("config.yaml")
@@ -57,6 +189,53 @@ func New() *Config {
 	return conf
 }
 
+//Reload reads the configuration again, without applying it. Only the backend configs, the clusters'
+//backend overrides, the routes, the retries and the deduplication window are taken from it, all other
+//settings only take effect on startup and are kept from the current configuration. Adding or removing a
+//cluster or changing its Marathon settings is refused, as subscriptions and event streams are set up on startup.
+func Reload() (*Config, error) {
+	next, err := configInit("config.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("%s", err.Message)
+	}
+	reloaded := *New()
+	if err := sameClusters(reloaded.Clusters, next.Clusters); err != nil {
+		return nil, err
+	}
+	reloaded.Backends = next.Backends
+	reloaded.Clusters = next.Clusters
+	reloaded.Routes = next.Routes
+	reloaded.Retries = next.Retries
+	reloaded.DedupWindow = next.DedupWindow
+	return &reloaded, nil
+}
+
+//sameClusters fails if the next clusters differ from the current ones in anything but their backend overrides
+func sameClusters(current, next map[string]Cluster) error {
+	for name, cluster := range next {
+		known, ok := current[name]
+		if !ok {
+			return fmt.Errorf("cluster '%s' was added, clusters only change on restart", name)
+		}
+		if cluster.Marathon != known.Marathon {
+			return fmt.Errorf("marathon settings of cluster '%s' changed, they only change on restart", name)
+		}
+	}
+	for name := range current {
+		if _, ok := next[name]; !ok {
+			return fmt.Errorf("cluster '%s' was removed, clusters only change on restart", name)
+		}
+	}
+	return nil
+}
+
+//Use makes a reloaded configuration the one returned by New
+func Use(config *Config) {
+	confMutex.Lock()
+	defer confMutex.Unlock()
+	conf = config
+}
+
 //configInit initializes Howler configuration
 func configInit(filename string) (*Config, *ConfigError) {
 	viper := viper.New()
@@ -0,0 +1,168 @@
+//Package deadletter keeps events which a backend failed to handle, so they can be inspected
+//and re-driven once the system behind the backend is working again.
+
+package deadletter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Attempt is a failed attempt to handle an event
+type Attempt struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+//Entry is an event a backend gave up on
+type Entry struct {
+	ID        uint64          `json:"id"`
+	Backend   string          `json:"backend"`
+	EventType string          `json:"eventType"`
+	AppID     string          `json:"appId,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  []Attempt       `json:"attempts"`
+	Created   time.Time       `json:"created"`
+}
+
+//Store holds the dead letters per backend. With a directory, every entry is persisted as a
+//file <dir>/<backend>/<id>.json, otherwise entries are kept in memory only.
+type Store struct {
+	mutex   sync.Mutex
+	dir     string
+	nextID  uint64
+	entries map[string]map[uint64]Entry
+}
+
+//Open loads the dead letters persisted in dir. An empty dir creates an in-memory store.
+func Open(dir string) (*Store, error) {
+	s := &Store{dir: dir, nextID: 1, entries: make(map[string]map[uint64]Entry)}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var entry Entry
+		if err := json.Unmarshal(content, &entry); err != nil {
+			return nil, fmt.Errorf("unable to read dead letter %s: %s", file, err)
+		}
+		s.put(entry)
+	}
+	return s, nil
+}
+
+//put adds the entry to the in-memory index
+func (s *Store) put(entry Entry) {
+	if s.entries[entry.Backend] == nil {
+		s.entries[entry.Backend] = make(map[uint64]Entry)
+	}
+	s.entries[entry.Backend][entry.ID] = entry
+	if entry.ID >= s.nextID {
+		s.nextID = entry.ID + 1
+	}
+}
+
+func (s *Store) path(backend string, id uint64) string {
+	return filepath.Join(s.dir, backend, strconv.FormatUint(id, 10)+".json")
+}
+
+//Add stores a dead letter and returns it with its id
+func (s *Store) Add(entry Entry) (Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if strings.ContainsAny(entry.Backend, `/\`) || entry.Backend == "" || entry.Backend[0] == '.' {
+		return entry, fmt.Errorf("invalid backend name '%s'", entry.Backend)
+	}
+	entry.ID = s.nextID
+	entry.Created = time.Now().UTC()
+	if s.dir != "" {
+		content, err := json.Marshal(entry)
+		if err != nil {
+			return entry, err
+		}
+		if err := os.MkdirAll(filepath.Join(s.dir, entry.Backend), 0700); err != nil {
+			return entry, err
+		}
+		// write to a temporary file first, so a crash never leaves a torn entry behind
+		path := s.path(entry.Backend, entry.ID)
+		if err := ioutil.WriteFile(path+".tmp", content, 0600); err != nil {
+			return entry, err
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return entry, err
+		}
+	}
+	s.put(entry)
+	return entry, nil
+}
+
+//Get returns a single dead letter
+func (s *Store) Get(backend string, id uint64) (Entry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.entries[backend][id]
+	return entry, ok
+}
+
+//List returns the dead letters of a backend, oldest first
+func (s *Store) List(backend string) []Entry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entries := []Entry{}
+	for _, entry := range s.entries[backend] {
+		entries = append(entries, entry)
+	}
+	sort.Sort(byID(entries))
+	return entries
+}
+
+type byID []Entry
+
+func (e byID) Len() int           { return len(e) }
+func (e byID) Swap(a, b int)      { e[a], e[b] = e[b], e[a] }
+func (e byID) Less(a, b int) bool { return e[a].ID < e[b].ID }
+
+//Remove discards a dead letter
+func (s *Store) Remove(backend string, id uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.entries[backend][id]; !ok {
+		return fmt.Errorf("no dead letter %d for backend '%s'", id, backend)
+	}
+	if s.dir != "" {
+		if err := os.Remove(s.path(backend, id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	delete(s.entries[backend], id)
+	return nil
+}
+
+//Sizes returns the number of dead letters per backend
+func (s *Store) Sizes() map[string]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sizes := make(map[string]int)
+	for backend, entries := range s.entries {
+		sizes[backend] = len(entries)
+	}
+	return sizes
+}
@@ -0,0 +1,52 @@
+package deadletter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func Test_Store(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, app := range []string{"/first", "/second"} {
+		if _, err := s.Add(Entry{Backend: "Baboon", AppID: app, Payload: []byte(`{}`), Attempts: []Attempt{{Error: "timeout"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Remove("Baboon", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(Entry{Backend: "../escape"}); err == nil {
+		fmt.Println("Expected an invalid backend name to be refused")
+		t.FailNow()
+	}
+
+	// the remaining dead letter survives a restart and ids are not reused
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := s.List("Baboon")
+	if len(entries) != 1 || entries[0].ID != 2 || entries[0].AppID != "/second" || entries[0].Attempts[0].Error != "timeout" {
+		fmt.Printf("Unexpected dead letters after restart: %+v\n", entries)
+		t.FailNow()
+	}
+	if entry, _ := s.Add(Entry{Backend: "Baboon"}); entry.ID != 3 {
+		fmt.Printf("Expected id 3, got: %d\n", entry.ID)
+		t.FailNow()
+	}
+	if sizes := s.Sizes(); sizes["Baboon"] != 2 {
+		fmt.Printf("Unexpected sizes: %v\n", sizes)
+		t.FailNow()
+	}
+}
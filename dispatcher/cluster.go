@@ -0,0 +1,43 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+)
+
+//Tag sets the cluster an event was received for in its payload, so it stays with the event in the journal,
+//the dead letters and replays. The cluster is taken from the route or stream only: an empty cluster removes
+//a cluster the payload claims, so events can not sneak into a cluster which is not configured.
+//Payloads which are not JSON objects are refused.
+func Tag(payload []byte, cluster string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("unable to decode event: %s", err)
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("unable to decode event: not a JSON object")
+	}
+	if cluster == "" {
+		if _, claimed := fields["cluster"]; !claimed {
+			return payload, nil
+		}
+		delete(fields, "cluster")
+		return json.Marshal(fields)
+	}
+	value, err := json.Marshal(cluster)
+	if err != nil {
+		return nil, err
+	}
+	fields["cluster"] = value
+	return json.Marshal(fields)
+}
+
+//scoped prefixes the id with the cluster of the event, so apps of different clusters sharing an id are kept apart
+func scoped(event interface{}, id string) string {
+	if cluster := backend.ClusterOf(event); cluster != "" {
+		return cluster + "|" + id
+	}
+	return id
+}
@@ -0,0 +1,104 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+)
+
+//clusterBackend remembers the cluster and team of all status updates
+type clusterBackend struct {
+	backend.DummyBackend
+	mutex   sync.Mutex
+	handled []string
+}
+
+func (be *clusterBackend) Name() string { return "Cluster" }
+func (be *clusterBackend) HandleUpdate(e backend.StatusUpdateEvent) error {
+	be.mutex.Lock()
+	defer be.mutex.Unlock()
+	var team string
+	if e.App != nil {
+		team = e.App.Labels["team"]
+	}
+	be.handled = append(be.handled, fmt.Sprintf("%s:%s", e.Cluster, team))
+	return nil
+}
+
+func Test_Tag(t *testing.T) {
+	running := []byte(`{"eventType": "status_update_event", "appId": "/shop/cart", "taskId": "1", "taskStatus": "TASK_RUNNING"}`)
+	payload, err := Tag(running, "eu-west")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, event, err := Decode(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster := backend.ClusterOf(event); cluster != "eu-west" {
+		fmt.Printf("Expected the event to come from eu-west, got: %s\n", cluster)
+		t.FailNow()
+	}
+	if untagged, _ := Tag(running, ""); string(untagged) != string(running) {
+		fmt.Println("Expected the default cluster to leave the payload unchanged")
+		t.FailNow()
+	}
+	for _, invalid := range []string{`not json`, `null`, `[1]`} {
+		if _, err := Tag([]byte(invalid), "eu-west"); err == nil {
+			fmt.Printf("Expected payload %s not to be tagged\n", invalid)
+			t.FailNow()
+		}
+		if _, err := Tag([]byte(invalid), ""); err == nil {
+			fmt.Printf("Expected payload %s to be refused for the default cluster\n", invalid)
+			t.FailNow()
+		}
+	}
+	claimed, err := Tag(payload, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, event, _ := Decode(claimed); backend.ClusterOf(event) != "" {
+		fmt.Println("Expected events of the default cluster not to claim another cluster")
+		t.FailNow()
+	}
+}
+
+func Test_Clusters(t *testing.T) {
+	be := &clusterBackend{}
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureDeduplication(time.Minute)
+	defer ConfigureDeduplication(0)
+	UseEnrichment(func(id string) (*backend.App, error) {
+		return &backend.App{ID: id, Labels: map[string]string{"team": "checkout"}}, nil
+	}, time.Minute)
+	UseClusterEnrichment("eu-west", func(id string) (*backend.App, error) {
+		return &backend.App{ID: id, Labels: map[string]string{"team": "payment"}}, nil
+	})
+	defer func() {
+		UseEnrichment(nil, 0)
+		UseClusterEnrichment("eu-west", nil)
+	}()
+
+	running := []byte(`{"eventType": "status_update_event", "appId": "/shop/cart", "taskId": "1", "taskStatus": "TASK_RUNNING"}`)
+	tagged, err := Tag(running, "eu-west")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same transition in another cluster is not a duplicate
+	for _, payload := range [][]byte{running, tagged, tagged} {
+		if err := Process(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Wait()
+	expected := []string{":checkout", "eu-west:payment"}
+	if fmt.Sprint(be.handled) != fmt.Sprint(expected) {
+		fmt.Printf("Expected %v, got: %v\n", expected, be.handled)
+		t.FailNow()
+	}
+}
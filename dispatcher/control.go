@@ -0,0 +1,173 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+)
+
+// states of a backend
+const (
+	BackendActive   = "active"   // events are handled
+	BackendPaused   = "paused"   // events are queued, beyond the queue size unless the overflow policy drops or rejects them
+	BackendDisabled = "disabled" // events are dropped
+)
+
+var (
+	// backendStates holds the backends which are not active
+	backendStates      = make(map[string]string)
+	backendStatesFile  string
+	backendStatesMutex sync.Mutex
+	// backendStatesCond wakes up the workers of paused backends
+	backendStatesCond = sync.NewCond(&backendStatesMutex)
+)
+
+//UseBackendStates loads the backend states kept in the file and keeps every change there.
+//A missing file means all backends are active.
+func UseBackendStates(path string) error {
+	states := make(map[string]string)
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &states); err != nil {
+			return fmt.Errorf("unable to decode backend states of %s: %s", path, err)
+		}
+	}
+	for name, state := range states {
+		switch state {
+		case BackendPaused, BackendDisabled:
+			glog.Infof("backend '%s' is %s", name, state)
+		case BackendActive:
+			delete(states, name)
+		default:
+			return fmt.Errorf("unknown state '%s' of backend '%s' in %s", state, name, path)
+		}
+	}
+	backendStatesMutex.Lock()
+	backendStates = states
+	backendStatesFile = path
+	backendStatesCond.Broadcast()
+	backendStatesMutex.Unlock()
+	wakePushes()
+	return nil
+}
+
+//SetBackendState pauses, disables or resumes a registered backend. Paused backends keep their events
+//queued, disabled backends drop them, including the ones queued already.
+func SetBackendState(name, state string) error {
+	switch state {
+	case BackendActive, BackendPaused, BackendDisabled:
+	default:
+		return fmt.Errorf("unknown backend state '%s'", state)
+	}
+	if lookup(name) == nil {
+		return fmt.Errorf("backend '%s' is not registered", name)
+	}
+	if err := changeBackendState(name, state); err != nil {
+		return err
+	}
+	// pushes waiting for the queue of a backend which is paused now must not wait any longer
+	wakePushes()
+	glog.Infof("backend '%s' is %s", name, state)
+	return nil
+}
+
+//changeBackendState keeps the new state of the backend and wakes up its workers
+func changeBackendState(name, state string) error {
+	backendStatesMutex.Lock()
+	defer backendStatesMutex.Unlock()
+	states := make(map[string]string)
+	for other, otherState := range backendStates {
+		states[other] = otherState
+	}
+	if state == BackendActive {
+		delete(states, name)
+	} else {
+		states[name] = state
+	}
+	if err := saveBackendStates(states); err != nil {
+		return fmt.Errorf("unable to keep the state of backend '%s': %s", name, err)
+	}
+	backendStates = states
+	backendStatesCond.Broadcast()
+	return nil
+}
+
+//saveBackendStates writes the states to the file, if there is one
+func saveBackendStates(states map[string]string) error {
+	if backendStatesFile == "" {
+		return nil
+	}
+	content, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first, so a crash never leaves a torn file behind
+	if err := ioutil.WriteFile(backendStatesFile+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(backendStatesFile+".tmp", backendStatesFile)
+}
+
+//backendState returns the state of the backend
+func backendState(name string) string {
+	backendStatesMutex.Lock()
+	defer backendStatesMutex.Unlock()
+	if state, ok := backendStates[name]; ok {
+		return state
+	}
+	return BackendActive
+}
+
+//awaitActive blocks while the backend is paused and reports whether it is disabled
+func awaitActive(name string) (disabled bool) {
+	backendStatesMutex.Lock()
+	defer backendStatesMutex.Unlock()
+	for backendStates[name] == BackendPaused {
+		backendStatesCond.Wait()
+	}
+	return backendStates[name] == BackendDisabled
+}
+
+//BackendInfo describes a registered backend
+type BackendInfo struct {
+	Name  string      `json:"name"`
+	State string      `json:"state"`
+	Queue *QueueStats `json:"queue,omitempty"` // nil until the backend got its first event
+}
+
+//Backends returns all registered backends with their state
+func Backends() []BackendInfo {
+	queues := Queues()
+	var infos []BackendInfo
+	for _, be := range backendconfig.RegisteredBackends {
+		info := BackendInfo{Name: be.Name(), State: backendState(be.Name())}
+		if stats, ok := queues[be.Name()]; ok {
+			info.Queue = &stats
+		}
+		infos = append(infos, info)
+	}
+	sort.Sort(byName(infos))
+	return infos
+}
+
+type byName []BackendInfo
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byName) Less(i, j int) bool { return b[i].Name < b[j].Name }
+
+//skipDisabled counts an event a disabled backend does not get as dropped
+func skipDisabled(name string) {
+	glog.V(2).Infof("backend '%s' is disabled, dropping event", name)
+	atomic.AddInt64(&queueFor(name).dropped, 1)
+}
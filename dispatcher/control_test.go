@@ -0,0 +1,210 @@
+package dispatcher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+	"github.com/zalando-techmonkeys/howler/conf"
+	"github.com/zalando-techmonkeys/howler/journal"
+)
+
+func Test_BackendStates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "howler-backends")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	be := newBlockingBackend("Controlled")
+	close(be.release)
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() {
+		backendconfig.RegisteredBackends = nil
+		UseBackendStates(filepath.Join(dir, "missing.json"))
+		backendStatesFile = ""
+	}()
+	path := filepath.Join(dir, "backends.json")
+	if err := UseBackendStates(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetBackendState("Unknown", BackendPaused); err == nil {
+		fmt.Println("Expected unregistered backends to be refused")
+		t.FailNow()
+	}
+
+	// paused backends keep their events queued
+	if err := SetBackendState("Controlled", BackendPaused); err != nil {
+		t.Fatal(err)
+	}
+	payload, event := statusUpdate("paused")
+	if err := Dispatch(payload, event); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case taskID := <-be.started:
+		fmt.Printf("Expected paused backend not to handle events, got: %s\n", taskID)
+		t.FailNow()
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := SetBackendState("Controlled", BackendActive); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-be.started:
+	case <-time.After(time.Second):
+		fmt.Println("Expected resumed backend to handle the queued event")
+		t.FailNow()
+	}
+
+	// disabled backends drop their events
+	if err := SetBackendState("Controlled", BackendDisabled); err != nil {
+		t.Fatal(err)
+	}
+	dropped := Queues()["Controlled"].Dropped
+	payload, event = statusUpdate("disabled")
+	if err := Dispatch(payload, event); err != nil {
+		t.Fatal(err)
+	}
+	if err := DispatchTo(payload, event, "Controlled"); err == nil {
+		fmt.Println("Expected events for a disabled backend to be refused")
+		t.FailNow()
+	}
+	if Queues()["Controlled"].Dropped != dropped+1 {
+		fmt.Printf("Expected 1 dropped event, got: %d\n", Queues()["Controlled"].Dropped-dropped)
+		t.FailNow()
+	}
+
+	// the states survive restarts
+	if err := UseBackendStates(path); err != nil {
+		t.Fatal(err)
+	}
+	backends := Backends()
+	if len(backends) != 1 || backends[0].State != BackendDisabled || backends[0].Queue == nil {
+		fmt.Printf("Expected the disabled state to be loaded, got: %+v\n", backends)
+		t.FailNow()
+	}
+}
+
+func Test_RecoverPausedBackend(t *testing.T) {
+	be := newBlockingBackend("PausedOnStart")
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureQueues(map[string]conf.Queue{"pausedonstart": {Size: 2, Workers: 1}})
+	if err := SetBackendState("PausedOnStart", BackendPaused); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBackendState("PausedOnStart", BackendActive)
+
+	// more events of an app than its shard holds must not block the startup
+	var entries []journal.Entry
+	for i := 0; i < 5; i++ {
+		payload, _ := statusUpdate(fmt.Sprintf("%d", i))
+		entries = append(entries, journal.Entry{ID: uint64(i + 1), Payload: payload, Backends: []string{"PausedOnStart"}})
+	}
+	recovered := make(chan struct{})
+	go func() {
+		Recover(entries)
+		close(recovered)
+	}()
+	select {
+	case <-recovered:
+	case <-time.After(time.Second):
+		fmt.Println("Expected recovering for a paused backend not to block")
+		t.FailNow()
+	}
+	if len(be.started) != 0 {
+		fmt.Println("Expected the paused backend not to handle the recovered events")
+		t.FailNow()
+	}
+	close(be.release)
+	if err := SetBackendState("PausedOnStart", BackendActive); err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+	if fmt.Sprint(be.tasks) != "[0 1 2 3 4]" {
+		fmt.Printf("Expected the recovered events in order, got: %v\n", be.tasks)
+		t.FailNow()
+	}
+}
+
+func Test_PausedBackendBlocksNoOne(t *testing.T) {
+	paused := newBlockingBackend("PausedFull")
+	other := newBlockingBackend("StillActive")
+	close(other.release)
+	backendconfig.RegisteredBackends = []backend.Plugin{paused, other}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureQueues(map[string]conf.Queue{"pausedfull": {Size: 1, Workers: 1}})
+	if err := SetBackendState("PausedFull", BackendPaused); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBackendState("PausedFull", BackendActive)
+
+	// the queue of the paused backend is full after the first event
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		for i := 1; i <= 5; i++ {
+			if err := Dispatch(statusUpdate(fmt.Sprintf("%d", i))); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 1; i <= 5; i++ {
+		select {
+		case <-other.started:
+		case <-time.After(time.Second):
+			fmt.Printf("Expected the paused backend not to hold up the other one, it got %d of 5 events\n", i-1)
+			t.FailNow()
+		}
+	}
+	<-dispatched
+	close(paused.release)
+	if err := SetBackendState("PausedFull", BackendActive); err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+	if fmt.Sprint(paused.tasks) != "[1 2 3 4 5]" {
+		fmt.Printf("Expected the resumed backend to handle all events in order, got: %v\n", paused.tasks)
+		t.FailNow()
+	}
+}
+
+func Test_RecoverThenDispatchOrdering(t *testing.T) {
+	be := newBlockingBackend("RecoveredFirst")
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureQueues(map[string]conf.Queue{"recoveredfirst": {Size: 1, Workers: 1}})
+
+	// the recovered events of the app fill its shard and backlog, live events of the app must wait behind them
+	var entries []journal.Entry
+	for i := 1; i <= 3; i++ {
+		payload, _ := statusUpdate(fmt.Sprintf("%d", i))
+		entries = append(entries, journal.Entry{ID: uint64(i), Payload: payload, Backends: []string{"RecoveredFirst"}})
+	}
+	Recover(entries)
+	<-be.started
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		for i := 4; i <= 6; i++ {
+			if err := Dispatch(statusUpdate(fmt.Sprintf("%d", i))); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(be.release)
+	<-dispatched
+	Wait()
+	if fmt.Sprint(be.tasks) != "[1 2 3 4 5 6]" {
+		fmt.Printf("Expected recovered events to be handled before live ones, got: %v\n", be.tasks)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,85 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/deadletter"
+)
+
+//deadLetters keeps the events the backends gave up on, in memory unless UseDeadLetters is called
+var deadLetters, _ = deadletter.Open("")
+
+//UseDeadLetters makes the dispatcher keep failed events in the given store
+func UseDeadLetters(s *deadletter.Store) {
+	deadLetters = s
+}
+
+//deadLetter stores an event the backend gave up on, together with the errors of all attempts
+func deadLetter(t task, name string, attempts []deadletter.Attempt) {
+	var event backend.Event
+	json.Unmarshal(t.payload, &event)
+	entry, err := deadLetters.Add(deadletter.Entry{
+		Backend:   name,
+		EventType: event.Eventtype,
+		AppID:     t.key,
+		Payload:   json.RawMessage(t.payload),
+		Attempts:  attempts,
+	})
+	if err != nil {
+		glog.Errorf("unable to store dead letter of event %d for backend '%s': %s", t.id, name, err)
+		return
+	}
+	glog.Warningf("stored event %d as dead letter %d of backend '%s'", t.id, entry.ID, name)
+}
+
+//DeadLetters returns the dead letters of a backend, oldest first
+func DeadLetters(backendName string) []deadletter.Entry {
+	return deadLetters.List(backendName)
+}
+
+//DeadLetter returns a single dead letter of a backend
+func DeadLetter(backendName string, id uint64) (deadletter.Entry, bool) {
+	return deadLetters.Get(backendName, id)
+}
+
+//Redrive dispatches a dead letter to its backend again and removes it from the dead letters
+func Redrive(backendName string, id uint64) error {
+	entry, ok := deadLetters.Get(backendName, id)
+	if !ok {
+		return fmt.Errorf("no dead letter %d for backend '%s'", id, backendName)
+	}
+	_, event, err := Decode(entry.Payload)
+	if err != nil {
+		return err
+	}
+	if err := DispatchTo(entry.Payload, event, backendName); err != nil {
+		return err
+	}
+	return deadLetters.Remove(backendName, id)
+}
+
+//Discard removes a dead letter without handling it
+func Discard(backendName string, id uint64) error {
+	return deadLetters.Remove(backendName, id)
+}
+
+//DeadLetterAspect exposes the number of dead letters per backend on the monitoring endpoint
+type DeadLetterAspect struct{}
+
+//GetStats returns the number of dead letters per backend
+func (a *DeadLetterAspect) GetStats() interface{} {
+	return deadLetters.Sizes()
+}
+
+//Name returns the name of the aspect
+func (a *DeadLetterAspect) Name() string {
+	return "DeadLetters"
+}
+
+//InRoot returns false, the stats are served at /DeadLetters
+func (a *DeadLetterAspect) InRoot() bool {
+	return false
+}
@@ -0,0 +1,70 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+	"github.com/zalando-techmonkeys/howler/conf"
+	"github.com/zalando-techmonkeys/howler/deadletter"
+)
+
+//outageBackend fails until the outage is over
+type outageBackend struct {
+	backend.DummyBackend
+	mutex   sync.Mutex
+	down    bool
+	handled []string
+}
+
+func (be *outageBackend) Name() string { return "Outage" }
+func (be *outageBackend) HandleUpdate(e backend.StatusUpdateEvent) error {
+	be.mutex.Lock()
+	defer be.mutex.Unlock()
+	if be.down {
+		return errors.New("backend unavailable")
+	}
+	be.handled = append(be.handled, e.Taskid)
+	return nil
+}
+
+func Test_DeadLetters(t *testing.T) {
+	be := &outageBackend{down: true}
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureRetries(map[string]conf.Retry{"outage": {MaxAttempts: 2, Backoff: 1, MaxBackoff: 1}})
+	store, _ := deadletter.Open("")
+	UseDeadLetters(store)
+
+	Process([]byte(`{"eventType": "status_update_event", "appId": "/my-app", "taskId": "1", "taskStatus": "TASK_RUNNING"}`))
+	Wait()
+	entries := DeadLetters("Outage")
+	if len(entries) != 1 {
+		fmt.Printf("Expected one dead letter, got: %+v\n", entries)
+		t.FailNow()
+	}
+	entry := entries[0]
+	if entry.EventType != "status_update_event" || entry.AppID != "/my-app" || len(entry.Attempts) != 2 || entry.Attempts[1].Error != "backend unavailable" {
+		fmt.Printf("Unexpected dead letter: %+v\n", entry)
+		t.FailNow()
+	}
+
+	be.mutex.Lock()
+	be.down = false
+	be.mutex.Unlock()
+	if err := Redrive("Outage", entry.ID); err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+	if len(be.handled) != 1 || be.handled[0] != "1" {
+		fmt.Printf("Expected the re-driven event to be handled, got: %v\n", be.handled)
+		t.FailNow()
+	}
+	if sizes := store.Sizes(); sizes["Outage"] != 0 {
+		fmt.Printf("Expected no dead letters after re-drive, got: %v\n", sizes)
+		t.FailNow()
+	}
+}
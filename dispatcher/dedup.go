@@ -0,0 +1,136 @@
+package dispatcher
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/backend"
+)
+
+//dedup remembers the logical transitions dispatched within the window
+type dedup struct {
+	mutex      sync.Mutex
+	window     time.Duration
+	seen       map[string]time.Time
+	lastSweep  time.Time
+	duplicates map[string]int64
+}
+
+var deduplication = &dedup{seen: make(map[string]time.Time), duplicates: make(map[string]int64)}
+
+//ConfigureDeduplication sets the window in which repeated events are dropped, zero disables deduplication
+func ConfigureDeduplication(window time.Duration) {
+	deduplication.mutex.Lock()
+	defer deduplication.mutex.Unlock()
+	deduplication.window = window
+	deduplication.seen = make(map[string]time.Time)
+}
+
+//dedupKey identifies the logical transition an event describes. Events without a key are never deduplicated.
+func dedupKey(event interface{}) string {
+	key := transition(event)
+	if key == "" {
+		return ""
+	}
+	return scoped(event, key)
+}
+
+func transition(event interface{}) string {
+	switch e := event.(type) {
+	case *backend.StatusUpdateEvent:
+		return fmt.Sprintf("%s|%s|%s|%s|%s", e.Eventtype, e.Appid, e.Taskid, e.Taskstatus, e.Version)
+	case *backend.HealthStatusChangedEvent:
+		return fmt.Sprintf("%s|%s|%s|%t|%s", e.Eventtype, e.Appid, e.Taskid, e.Alive, e.Version)
+	case *backend.APIRequestEvent:
+		// without a version two different changes of an app can not be told apart
+		if e.Appdefinition.Version != "" {
+			return fmt.Sprintf("%s|%s|%s", e.Eventtype, e.Appdefinition.ID, e.Appdefinition.Version)
+		}
+	case *backend.AppTerminatedEvent:
+		// an app can be terminated, created again and terminated again within the window, only re-deliveries
+		// of a termination share its timestamp
+		if e.Timestamp != "" {
+			return fmt.Sprintf("%s|%s|%s", e.Eventtype, e.Appid, e.Timestamp)
+		}
+	}
+	return ""
+}
+
+//claim records the key and reports whether it was not seen within the window
+func (d *dedup) claim(key string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.window <= 0 || key == "" {
+		return true
+	}
+	now := time.Now()
+	if now.Sub(d.lastSweep) > d.window {
+		for k, seen := range d.seen {
+			if now.Sub(seen) > d.window {
+				delete(d.seen, k)
+			}
+		}
+		d.lastSweep = now
+	}
+	if seen, ok := d.seen[key]; ok && now.Sub(seen) <= d.window {
+		// keys start with the event type
+		d.duplicates[strings.SplitN(key, "|", 2)[0]]++
+		return false
+	}
+	d.seen[key] = now
+	return true
+}
+
+//release forgets a key again, used if the claimed event could not be dispatched
+func (d *dedup) release(key string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.seen, key)
+}
+
+//Duplicates returns the number of dropped duplicates per event type
+func Duplicates() map[string]int64 {
+	deduplication.mutex.Lock()
+	defer deduplication.mutex.Unlock()
+	counts := make(map[string]int64)
+	for eventType, count := range deduplication.duplicates {
+		counts[eventType] = count
+	}
+	return counts
+}
+
+//deduplicate reports whether the event is a duplicate, in which case it must not be dispatched.
+//The returned function has to be called if the event was not dispatched after all.
+func deduplicate(event interface{}) (bool, func()) {
+	key := dedupKey(event)
+	if !deduplication.claim(key) {
+		glog.Infof("dropping duplicate event %s", key)
+		return true, nil
+	}
+	return false, func() {
+		if key != "" {
+			deduplication.release(key)
+		}
+	}
+}
+
+//DuplicatesAspect exposes the number of dropped duplicates on the monitoring endpoint
+type DuplicatesAspect struct{}
+
+//GetStats returns the number of dropped duplicates per event type
+func (a *DuplicatesAspect) GetStats() interface{} {
+	return Duplicates()
+}
+
+//Name returns the name of the aspect
+func (a *DuplicatesAspect) Name() string {
+	return "Duplicates"
+}
+
+//InRoot returns false, the stats are served at /Duplicates
+func (a *DuplicatesAspect) InRoot() bool {
+	return false
+}
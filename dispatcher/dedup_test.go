@@ -0,0 +1,58 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+)
+
+func Test_Deduplication(t *testing.T) {
+	be := &recordingBackend{}
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureDeduplication(time.Minute)
+	defer ConfigureDeduplication(0)
+	before := Duplicates()["status_update_event"]
+
+	running := []byte(`{"eventType": "status_update_event", "appId": "/my-app", "taskId": "1", "taskStatus": "TASK_RUNNING", "version": "v1"}`)
+	killed := []byte(`{"eventType": "status_update_event", "appId": "/my-app", "taskId": "1", "taskStatus": "TASK_KILLED", "version": "v1"}`)
+	for _, payload := range [][]byte{running, running, killed, running} {
+		if err := Process(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Wait()
+	if len(be.tasks) != 2 {
+		fmt.Printf("Expected 2 handled events, got: %v\n", be.tasks)
+		t.FailNow()
+	}
+	if duplicates := Duplicates()["status_update_event"] - before; duplicates != 2 {
+		fmt.Printf("Expected 2 duplicates, got: %d\n", duplicates)
+		t.FailNow()
+	}
+}
+
+func Test_DeduplicationTerminated(t *testing.T) {
+	backendconfig.RegisteredBackends = []backend.Plugin{&recordingBackend{}}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureDeduplication(time.Minute)
+	defer ConfigureDeduplication(0)
+	before := Duplicates()["app_terminated_event"]
+
+	// the app is terminated, created again and terminated again, the first termination is re-delivered
+	terminated := []byte(`{"eventType": "app_terminated_event", "appId": "/my-app", "timestamp": "2016-03-01T10:00:00.000Z"}`)
+	again := []byte(`{"eventType": "app_terminated_event", "appId": "/my-app", "timestamp": "2016-03-01T10:00:30.000Z"}`)
+	for _, payload := range [][]byte{terminated, again, terminated} {
+		if err := Process(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Wait()
+	if duplicates := Duplicates()["app_terminated_event"] - before; duplicates != 1 {
+		fmt.Printf("Expected only the re-delivery to be dropped, got %d duplicates\n", duplicates)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,388 @@
+//Package dispatcher decodes Marathon events and hands them over to the registered backends.
+
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kr/pretty"
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+	"github.com/zalando-techmonkeys/howler/deadletter"
+	"github.com/zalando-techmonkeys/howler/journal"
+)
+
+//Decode reads the eventType of a raw Marathon event, unmarshals the event into its typed representation
+//and validates it. Payloads failing this are counted as rejected.
+func Decode(payload []byte) (string, interface{}, error) {
+	eventType, event, err := decode(payload)
+	if err != nil {
+		reject(eventType)
+	}
+	return eventType, event, err
+}
+
+func decode(payload []byte) (string, interface{}, error) {
+	var event backend.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return "", nil, fmt.Errorf("unable to decode event: %s", err)
+	}
+	newEvent, ok := backend.EventTypes[event.Eventtype]
+	if !ok {
+		return event.Eventtype, nil, fmt.Errorf("event type '%s' is not dispatched to any backend", event.Eventtype)
+	}
+	typedEvent := newEvent()
+	if err := json.Unmarshal(payload, typedEvent); err != nil {
+		return event.Eventtype, nil, fmt.Errorf("unable to decode event of type '%s': %s", event.Eventtype, err)
+	}
+	if err := validate(event.Eventtype, typedEvent); err != nil {
+		return event.Eventtype, nil, err
+	}
+	return event.Eventtype, typedEvent, nil
+}
+
+//eventJournal stores accepted events until all backends handled them, nil if disabled
+var eventJournal *journal.Journal
+
+//inflight counts the events which are queued or handled by a backend
+var inflight inflightCounter
+
+//Wait blocks until all dispatched events are handled by the backends
+func Wait() {
+	inflight.Wait()
+}
+
+//UseJournal makes the dispatcher write every accepted event to the journal before dispatching it
+func UseJournal(j *journal.Journal) {
+	eventJournal = j
+}
+
+//Process decodes a raw Marathon event and dispatches it. All event sources feed events in here.
+func Process(payload []byte) error {
+	_, event, err := Decode(payload)
+	if err != nil {
+		return err
+	}
+	return Dispatch(payload, event)
+}
+
+//Dispatch applies the event to the cluster state, journals it and enqueues it for every registered
+//backend interested in it. Events repeating a transition already dispatched within the deduplication window are dropped.
+func Dispatch(payload []byte, event interface{}) error {
+	return deduplicated(payload, event, nil)
+}
+
+//DispatchAndWait works like Dispatch, but waits up to timeout until the backends handled the event
+//and returns their outcomes. Backends which did not finish in time are reported as pending.
+func DispatchAndWait(payload []byte, event interface{}, timeout time.Duration) ([]Outcome, error) {
+	t := newTracker()
+	if err := deduplicated(payload, event, t); err != nil {
+		return nil, err
+	}
+	return t.wait(timeout), nil
+}
+
+func deduplicated(payload []byte, event interface{}, t *tracker) error {
+	track(event)
+	duplicate, release := deduplicate(event)
+	if duplicate {
+		if t != nil {
+			t.expect(nil)
+		}
+		return nil
+	}
+	if err := dispatch(payload, event, "", t); err != nil {
+		release()
+		return err
+	}
+	return nil
+}
+
+//DispatchTo works like Dispatch, but only notifies the named backend. An empty name notifies all backends.
+//Only the leader dispatches on purpose, followers get ErrFollowing.
+func DispatchTo(payload []byte, event interface{}, backendName string) error {
+	// a follower would keep the event for a takeover, which might never happen
+	if !Leading() {
+		return ErrFollowing
+	}
+	if backendName != "" && lookup(backendName) == nil {
+		return fmt.Errorf("backend '%s' is not registered", backendName)
+	}
+	return dispatch(payload, event, backendName, nil)
+}
+
+//dispatchMutex serializes accepting events: the journal, the leadership and the standby events.
+//It is not held while the events are queued, so a full queue does not hold up accepting further events.
+var dispatchMutex sync.Mutex
+
+//dispatch enqueues the event for the backends, their outcomes are reported to the tracker, if it is not nil
+func dispatch(payload []byte, event interface{}, backendName string, t *tracker) error {
+	enrich(event)
+	glog.Infof("dispatching to backends: %# v", pretty.Formatter(event))
+	var names []string
+	handlers := make(map[string]func() error)
+	for _, backendImplementation := range backendconfig.RegisteredBackends {
+		if backendName != "" && backendImplementation.Name() != backendName {
+			continue
+		}
+		// events for a named backend are sent on purpose, routing rules do not apply to them
+		if backendName == "" && !routed(backendImplementation.Name(), event) {
+			continue
+		}
+		handle := handler(backendImplementation, event)
+		if handle == nil {
+			continue
+		}
+		if backendState(backendImplementation.Name()) == BackendDisabled {
+			if backendName != "" {
+				return fmt.Errorf("backend '%s' is disabled", backendName)
+			}
+			skipDisabled(backendImplementation.Name())
+			continue
+		}
+		names = append(names, backendImplementation.Name())
+		handlers[backendImplementation.Name()] = handle
+	}
+	learnLabels(event)
+
+	dispatchMutex.Lock()
+	if atomic.LoadInt32(&draining) == 1 {
+		dispatchMutex.Unlock()
+		return ErrShuttingDown
+	}
+	key := backend.AppID(event)
+	accepted := time.Now()
+	var id uint64
+	if eventJournal != nil {
+		var err error
+		if id, err = eventJournal.Append(payload, names); err != nil {
+			dispatchMutex.Unlock()
+			return err
+		}
+	}
+	if t != nil {
+		t.expect(names)
+	}
+	if !Leading() {
+		standBy(standbyEntry{id: id, key: key, payload: payload, names: names, handlers: handlers, accepted: accepted})
+		dispatchMutex.Unlock()
+		for _, name := range names {
+			t.report(Outcome{Backend: name, Status: OutcomeStandby})
+		}
+		return nil
+	}
+	// counted before unlocking, so Drain does not miss events which are about to be queued
+	inflight.Add(accepted, len(names))
+	dispatchMutex.Unlock()
+
+	// backends with free space get the event first, so a full queue with the block policy only holds up the
+	// dispatch once the other backends have the event. Paused backends never hold it up. The events of an app
+	// keep their order anyway as they always go to the same shard.
+	var full []string
+	var rejected int
+	var err error
+	for _, name := range names {
+		glog.Infof("dispatching event to backend '%s'", name)
+		queued, pushErr := queueFor(name).push(task{id: id, key: key, payload: payload, handle: handlers[name], tracker: t, accepted: accepted}, false)
+		if pushErr != nil {
+			glog.Warningf("backend '%s' rejected event %d: %s", name, id, pushErr)
+			inflight.Done(accepted)
+			complete(id, name)
+			t.report(Outcome{Backend: name, Status: OutcomeDropped, Error: pushErr.Error()})
+			rejected, err = rejected+1, pushErr
+		} else if !queued {
+			full = append(full, name)
+		}
+	}
+	for _, name := range full {
+		queueFor(name).push(task{id: id, key: key, payload: payload, handle: handlers[name], tracker: t, accepted: accepted}, true)
+	}
+	// the event is refused as a whole only if no backend took it
+	if rejected > 0 && rejected == len(names) {
+		return err
+	}
+	return nil
+}
+
+//Recover re-dispatches journal entries to the backends which did not handle them before the last shutdown.
+//A follower keeps them until it becomes leader.
+func Recover(entries []journal.Entry) {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+	for _, entry := range entries {
+		_, event, err := Decode(entry.Payload)
+		if err == nil {
+			enrich(event)
+		}
+		key := backend.AppID(event)
+		handlers := make(map[string]func() error)
+		for _, name := range entry.Backends {
+			var handle func() error
+			if be := lookup(name); be != nil && err == nil {
+				handle = handler(be, event)
+			}
+			if handle == nil {
+				// the backend is not compiled in anymore or the event can not be handled at all
+				glog.Warningf("dropping journaled event %d for backend '%s'", entry.ID, name)
+				complete(entry.ID, name)
+				continue
+			}
+			handlers[name] = handle
+		}
+		if !Leading() {
+			standByRecovered(entry, key, handlers)
+			continue
+		}
+		for _, name := range entry.Backends {
+			if handlers[name] == nil {
+				continue
+			}
+			glog.Infof("re-dispatching journaled event %d to backend '%s'", entry.ID, name)
+			// recovered events were accepted before, they must not be rejected now
+			accepted := time.Now()
+			inflight.Add(accepted, 1)
+			queueFor(name).accept(task{id: entry.ID, key: key, payload: entry.Payload, handle: handlers[name], accepted: accepted})
+		}
+	}
+}
+
+//lookup returns the registered backend with the given name
+func lookup(name string) backend.Plugin {
+	for _, backendImplementation := range backendconfig.RegisteredBackends {
+		if backendImplementation.Name() == name {
+			return backendImplementation
+		}
+	}
+	return nil
+}
+
+//run delivers the event, retrying failures, and marks it as done for the backend afterwards.
+//Events the backend gives up on end up in the dead letters.
+func run(t task, name string) {
+	defer inflight.Done(t.accepted)
+	policy := retryFor(name)
+	start := time.Now()
+	outcome := Outcome{Backend: name, Status: OutcomeHandled}
+	var attempts []deadletter.Attempt
+	for attempt := 1; ; attempt++ {
+		outcome.Attempts = attempt
+		err := t.handle()
+		if err == nil {
+			break
+		}
+		attempts = append(attempts, deadletter.Attempt{Time: time.Now().UTC(), Error: err.Error()})
+		if backend.IsPermanent(err) || attempt >= policy.maxAttempts {
+			glog.Errorf("backend '%s' failed to handle event %d after %d attempts: %s", name, t.id, attempt, err)
+			outcome.Status, outcome.Error = OutcomeFailed, err.Error()
+			deadLetter(t, name, attempts)
+			break
+		}
+		delay := policy.delay(attempt)
+		glog.Warningf("backend '%s' failed to handle event %d, retrying in %s: %s", name, t.id, delay, err)
+		time.Sleep(delay)
+	}
+	complete(t.id, name)
+	outcome.DurationMs = int64(time.Since(start) / time.Millisecond)
+	t.tracker.report(outcome)
+}
+
+func complete(id uint64, name string) {
+	if eventJournal == nil {
+		return
+	}
+	if err := eventJournal.Complete(id, name); err != nil {
+		glog.Error(err)
+	}
+}
+
+//handler returns the function delivering the event to the backend,
+//or nil if the backend does not implement the handler for this event type
+func handler(be backend.Plugin, event interface{}) func() error {
+	reporting, _ := be.(backend.ReportingBackend)
+	void, _ := be.(backend.Backend)
+	switch e := event.(type) {
+	case *backend.APIRequestEvent:
+		if reporting != nil {
+			return func() error { return reporting.HandleCreate(*e) }
+		}
+		if void != nil {
+			return func() error { void.HandleCreate(*e); return nil }
+		}
+	case *backend.StatusUpdateEvent:
+		if reporting != nil {
+			return func() error { return reporting.HandleUpdate(*e) }
+		}
+		if void != nil {
+			return func() error { void.HandleUpdate(*e); return nil }
+		}
+	case *backend.AppTerminatedEvent:
+		if reporting != nil {
+			return func() error { return reporting.HandleDestroy(*e) }
+		}
+		if void != nil {
+			return func() error { void.HandleDestroy(*e); return nil }
+		}
+	case *backend.AddHealthCheckEvent:
+		if h, ok := be.(backend.HealthEventHandler); ok {
+			return func() error { return h.HandleHealthCheckAdded(*e) }
+		}
+	case *backend.RemoveHealthCheckEvent:
+		if h, ok := be.(backend.HealthEventHandler); ok {
+			return func() error { return h.HandleHealthCheckRemoved(*e) }
+		}
+	case *backend.FailedHealthCheckEvent:
+		if h, ok := be.(backend.HealthEventHandler); ok {
+			return func() error { return h.HandleHealthCheckFailed(*e) }
+		}
+	case *backend.HealthStatusChangedEvent:
+		if h, ok := be.(backend.HealthEventHandler); ok {
+			return func() error { return h.HandleHealthStatusChanged(*e) }
+		}
+	case *backend.GroupChangeSuccessEvent:
+		if h, ok := be.(backend.GroupEventHandler); ok {
+			return func() error { return h.HandleGroupChangeSuccess(*e) }
+		}
+	case *backend.GroupChangeFailedEvent:
+		if h, ok := be.(backend.GroupEventHandler); ok {
+			return func() error { return h.HandleGroupChangeFailed(*e) }
+		}
+	case *backend.DeploymentSuccessEvent:
+		if h, ok := be.(backend.DeploymentEventHandler); ok {
+			return func() error { return h.HandleDeploymentSuccess(*e) }
+		}
+	case *backend.DeploymentFailedEvent:
+		if h, ok := be.(backend.DeploymentEventHandler); ok {
+			return func() error { return h.HandleDeploymentFailed(*e) }
+		}
+	case *backend.DeploymentInfoEvent:
+		if h, ok := be.(backend.DeploymentEventHandler); ok {
+			return func() error { return h.HandleDeploymentInfo(*e) }
+		}
+	case *backend.DeploymentStepSuccessEvent:
+		if h, ok := be.(backend.DeploymentEventHandler); ok {
+			return func() error { return h.HandleDeploymentStepSuccess(*e) }
+		}
+	case *backend.DeploymentStepFailureEvent:
+		if h, ok := be.(backend.DeploymentEventHandler); ok {
+			return func() error { return h.HandleDeploymentStepFailure(*e) }
+		}
+	case *backend.FrameworkMessageEvent:
+		if h, ok := be.(backend.FrameworkMessageHandler); ok {
+			return func() error { return h.HandleFrameworkMessage(*e) }
+		}
+	case *backend.SubscribeEvent:
+		if h, ok := be.(backend.SubscriptionEventHandler); ok {
+			return func() error { return h.HandleSubscribe(*e) }
+		}
+	case *backend.UnsubscribeEvent:
+		if h, ok := be.(backend.SubscriptionEventHandler); ok {
+			return func() error { return h.HandleUnsubscribe(*e) }
+		}
+	}
+	return nil
+}
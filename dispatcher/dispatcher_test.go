@@ -0,0 +1,129 @@
+package dispatcher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+)
+
+//healthBackend is a backend implementing the optional HealthEventHandler
+type healthBackend struct {
+	backend.DummyBackend
+	changed []backend.HealthStatusChangedEvent
+}
+
+func (be *healthBackend) HandleHealthCheckAdded(e backend.AddHealthCheckEvent) error      { return nil }
+func (be *healthBackend) HandleHealthCheckRemoved(e backend.RemoveHealthCheckEvent) error { return nil }
+func (be *healthBackend) HandleHealthCheckFailed(e backend.FailedHealthCheckEvent) error  { return nil }
+func (be *healthBackend) HandleHealthStatusChanged(e backend.HealthStatusChangedEvent) error {
+	be.changed = append(be.changed, e)
+	return nil
+}
+
+func Test_Decode(t *testing.T) {
+	payload, err := ioutil.ReadFile("../marathon-events/statusupdate.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventType, event, err := Decode(payload)
+	if err != nil {
+		fmt.Printf("VALID event is failing: %s\n", err)
+		t.FailNow()
+	}
+	if eventType != "status_update_event" {
+		fmt.Printf("Expected: status_update_event, got: %s\n", eventType)
+		t.FailNow()
+	}
+	statusUpdate, ok := event.(*backend.StatusUpdateEvent)
+	if !ok {
+		fmt.Printf("Expected: *backend.StatusUpdateEvent, got: %T\n", event)
+		t.FailNow()
+	}
+	if statusUpdate.Taskstatus != "TASK_RUNNING" {
+		fmt.Printf("Expected: TASK_RUNNING, got: %s\n", statusUpdate.Taskstatus)
+		t.FailNow()
+	}
+
+	_, _, err = Decode([]byte(`{"eventType": "no_such_event"}`))
+	if err == nil {
+		fmt.Println("UNKNOWN event type is accepted")
+		t.FailNow()
+	}
+}
+
+func Test_handler(t *testing.T) {
+	healthChanged := &backend.HealthStatusChangedEvent{Appid: "/my-app", Alive: true}
+	if handler(&backend.DummyBackend{}, healthChanged) != nil {
+		fmt.Println("health event dispatched to backend without HealthEventHandler")
+		t.FailNow()
+	}
+	be := &healthBackend{}
+	handle := handler(be, healthChanged)
+	if handle == nil {
+		fmt.Println("health event not dispatched to HealthEventHandler")
+		t.FailNow()
+	}
+	handle()
+	if len(be.changed) != 1 || be.changed[0].Appid != "/my-app" {
+		fmt.Printf("Expected one event for /my-app, got: %+v\n", be.changed)
+		t.FailNow()
+	}
+	if handler(be, &backend.DeploymentSuccessEvent{}) != nil {
+		fmt.Println("deployment event dispatched to backend without DeploymentEventHandler")
+		t.FailNow()
+	}
+}
+
+//recordingBackend remembers the task ids of all status updates
+type recordingBackend struct {
+	backend.DummyBackend
+	mutex sync.Mutex
+	tasks []string
+}
+
+func (be *recordingBackend) Name() string { return "Recording" }
+func (be *recordingBackend) HandleUpdate(e backend.StatusUpdateEvent) error {
+	be.mutex.Lock()
+	defer be.mutex.Unlock()
+	be.tasks = append(be.tasks, e.Taskid)
+	return nil
+}
+
+func Test_Replay(t *testing.T) {
+	be := &recordingBackend{}
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+
+	capture := strings.NewReader(`{"eventType": "status_update_event", "appId": "/my-app", "taskId": "1", "taskStatus": "TASK_RUNNING"}
+
+not json
+{"eventType": "status_update_event", "appId": "/my-app", "taskId": "2", "taskStatus": "TASK_RUNNING"}
+`)
+	result, err := Replay(capture, "Recording", 1000)
+	Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Replayed != 2 || len(result.Failed) != 1 || result.Failed[0].Line != 3 {
+		fmt.Printf("Expected 2 replayed events and line 3 failing, got: %+v\n", result)
+		t.FailNow()
+	}
+	if len(be.tasks) != 2 {
+		fmt.Printf("Expected 2 handled events, got: %v\n", be.tasks)
+		t.FailNow()
+	}
+
+	// rates beyond a tick per nanosecond are capped instead of breaking the throttle
+	if _, err := Replay(strings.NewReader(""), "Recording", 2000000000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Replay(strings.NewReader(""), "Baboon", 0); err == nil {
+		fmt.Println("replay to unregistered backend is accepted")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,111 @@
+package dispatcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/backend"
+)
+
+//cachedApp is an app definition with the time it was fetched, nil if fetching it failed
+type cachedApp struct {
+	app     *backend.App
+	fetched time.Time
+}
+
+//failedFetchTTL is how long a failed fetch is cached, so events of an unknown app or of an unreachable Marathon
+//do not wait for a fetch each. It is capped by the ttl of the definitions.
+var failedFetchTTL = 10 * time.Second
+
+//appCache holds the app definitions attached to events, by the app id scoped to its cluster
+type appCache struct {
+	mutex   sync.Mutex
+	fetches map[string]func(id string) (*backend.App, error) // by cluster
+	ttl     time.Duration
+	apps    map[string]cachedApp
+}
+
+var apps = &appCache{fetches: make(map[string]func(id string) (*backend.App, error)), apps: make(map[string]cachedApp)}
+
+//UseEnrichment makes the dispatcher attach the current app definition to every event referring to an app.
+//Definitions are fetched with fetch, p.e. from Marathon's /v2/apps, and cached for ttl.
+func UseEnrichment(fetch func(id string) (*backend.App, error), ttl time.Duration) {
+	apps.mutex.Lock()
+	defer apps.mutex.Unlock()
+	apps.fetches[""] = fetch
+	apps.ttl = ttl
+	apps.apps = make(map[string]cachedApp)
+}
+
+//UseClusterEnrichment works like UseEnrichment for the events of a further cluster, they are cached for
+//the ttl passed to UseEnrichment
+func UseClusterEnrichment(cluster string, fetch func(id string) (*backend.App, error)) {
+	apps.mutex.Lock()
+	defer apps.mutex.Unlock()
+	apps.fetches[cluster] = fetch
+}
+
+//get returns the definition of the app of the cluster, from the cache if it is fresh enough
+func (c *appCache) get(cluster string, key string, id string) *backend.App {
+	c.mutex.Lock()
+	fetch := c.fetches[cluster]
+	cached, ok := c.apps[key]
+	c.mutex.Unlock()
+	if fetch == nil {
+		return nil
+	}
+	if ok && time.Since(cached.fetched) < c.ttlOf(cached) {
+		return cached.app
+	}
+	app, err := fetch(id)
+	if err != nil {
+		glog.Warningf("unable to fetch definition of app %s, dispatching event without it: %s", key, err)
+		app = nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.apps[key] = cachedApp{app: app, fetched: time.Now()}
+	return app
+}
+
+//ttlOf returns how long the cached definition is fresh
+func (c *appCache) ttlOf(cached cachedApp) time.Duration {
+	if cached.app == nil && failedFetchTTL < c.ttl {
+		return failedFetchTTL
+	}
+	return c.ttl
+}
+
+//invalidate drops the cached definition of the app
+func (c *appCache) invalidate(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.apps, key)
+}
+
+//enrich attaches the app definition to the event. Changes to an app invalidate its cached definition,
+//so the next events of the app get the new one.
+func enrich(event interface{}) {
+	id := backend.AppID(event)
+	if id == "" {
+		return
+	}
+	key := scoped(event, id)
+	switch event.(type) {
+	case *backend.APIRequestEvent, *backend.AppTerminatedEvent:
+		apps.invalidate(key)
+	}
+	if _, terminated := event.(*backend.AppTerminatedEvent); terminated {
+		return
+	}
+	e, ok := event.(interface {
+		Enrich(*backend.App)
+	})
+	if !ok {
+		return
+	}
+	if app := apps.get(backend.ClusterOf(event), key, id); app != nil {
+		e.Enrich(app)
+	}
+}
@@ -0,0 +1,96 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+)
+
+//teamBackend remembers the team labels of the apps of all status updates
+type teamBackend struct {
+	backend.DummyBackend
+	mutex sync.Mutex
+	teams []string
+}
+
+func (be *teamBackend) Name() string { return "Team" }
+func (be *teamBackend) HandleUpdate(e backend.StatusUpdateEvent) error {
+	be.mutex.Lock()
+	defer be.mutex.Unlock()
+	if e.App == nil {
+		be.teams = append(be.teams, "")
+		return nil
+	}
+	be.teams = append(be.teams, e.App.Labels["team"])
+	return nil
+}
+
+func Test_Enrichment(t *testing.T) {
+	be := &teamBackend{}
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	team := "checkout"
+	fetched := 0
+	UseEnrichment(func(id string) (*backend.App, error) {
+		fetched++
+		return &backend.App{ID: id, Labels: map[string]string{"team": team}}, nil
+	}, time.Minute)
+	defer UseEnrichment(nil, 0)
+
+	running := []byte(`{"eventType": "status_update_event", "appId": "/shop/cart", "taskId": "1", "taskStatus": "TASK_RUNNING"}`)
+	Process(running)
+	Process(running)
+	// changing the app invalidates its cached definition
+	team = "payment"
+	Process([]byte(`{"eventType": "api_post_event", "appDefinition": {"id": "/shop/cart"}}`))
+	Process(running)
+	Wait()
+	if fetched != 2 {
+		fmt.Printf("Expected 2 fetches, got: %d\n", fetched)
+		t.FailNow()
+	}
+	expected := []string{"checkout", "checkout", "payment"}
+	if fmt.Sprint(be.teams) != fmt.Sprint(expected) {
+		fmt.Printf("Expected teams %v, got: %v\n", expected, be.teams)
+		t.FailNow()
+	}
+}
+
+func Test_EnrichmentFailureCached(t *testing.T) {
+	be := &teamBackend{}
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	defer func(ttl time.Duration) { failedFetchTTL = ttl }(failedFetchTTL)
+	failedFetchTTL = 50 * time.Millisecond
+	fetched := 0
+	UseEnrichment(func(id string) (*backend.App, error) {
+		fetched++
+		return nil, fmt.Errorf("GET /v2/apps%s returned 404 Not Found", id)
+	}, time.Minute)
+	defer UseEnrichment(nil, 0)
+
+	running := []byte(`{"eventType": "status_update_event", "appId": "/shop/gone", "taskId": "1", "taskStatus": "TASK_RUNNING"}`)
+	Process(running)
+	Process(running)
+	Wait()
+	if fetched != 1 {
+		fmt.Printf("Expected the failed fetch to be cached, got %d fetches\n", fetched)
+		t.FailNow()
+	}
+	// failures are cached shorter than definitions
+	time.Sleep(2 * failedFetchTTL)
+	Process(running)
+	Wait()
+	if fetched != 2 {
+		fmt.Printf("Expected the failed fetch to expire, got %d fetches\n", fetched)
+		t.FailNow()
+	}
+	if fmt.Sprint(be.teams) != fmt.Sprint([]string{"", "", ""}) {
+		fmt.Printf("Expected events without app definition, got teams: %v\n", be.teams)
+		t.FailNow()
+	}
+}
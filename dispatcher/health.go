@@ -0,0 +1,116 @@
+package dispatcher
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+)
+
+// health of a backend
+const (
+	HealthUp      = "up"
+	HealthDown    = "down"
+	HealthUnknown = "unknown" // the backend can not check its health or is disabled
+)
+
+//healthCheckTimeout bounds the health check of a backend, also if it does not bound its requests itself
+var healthCheckTimeout = 10 * time.Second
+
+//BackendHealth is the result of the health check of a backend
+type BackendHealth struct {
+	Backend     string     `json:"backend"`
+	Status      string     `json:"status"`
+	State       string     `json:"state"`
+	Critical    bool       `json:"critical"`
+	LatencyMs   int64      `json:"latencyMs"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+//healthError is the last failed health check of a backend
+type healthError struct {
+	message string
+	at      time.Time
+}
+
+var (
+	criticalBackends map[string]bool // nil if all backends are critical
+	lastHealthErrors = make(map[string]healthError)
+	healthMutex      sync.Mutex
+)
+
+//ConfigureHealth sets the backends whose failed health check makes Howler unhealthy, all if the list is empty
+func ConfigureHealth(critical []string) {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	criticalBackends = nil
+	if len(critical) == 0 {
+		return
+	}
+	criticalBackends = make(map[string]bool)
+	for _, name := range critical {
+		criticalBackends[strings.ToLower(name)] = true
+	}
+}
+
+//CheckHealth runs the health checks of all registered backends implementing backend.HealthChecker concurrently
+//and reports whether all critical backends are up. Disabled backends are not checked.
+func CheckHealth() ([]BackendHealth, bool) {
+	results := make([]BackendHealth, len(backendconfig.RegisteredBackends))
+	var wait sync.WaitGroup
+	for i, be := range backendconfig.RegisteredBackends {
+		results[i] = BackendHealth{Backend: be.Name(), Status: HealthUnknown, State: backendState(be.Name())}
+		checker, ok := be.(backend.HealthChecker)
+		if !ok || results[i].State == BackendDisabled {
+			continue
+		}
+		wait.Add(1)
+		go func(result *BackendHealth) {
+			defer wait.Done()
+			start := time.Now()
+			err := checkHealth(checker)
+			result.LatencyMs = int64(time.Since(start) / time.Millisecond)
+			result.Status = HealthUp
+			if err != nil {
+				result.Status = HealthDown
+				healthMutex.Lock()
+				lastHealthErrors[result.Backend] = healthError{message: err.Error(), at: time.Now().UTC()}
+				healthMutex.Unlock()
+			}
+		}(&results[i])
+	}
+	wait.Wait()
+
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	healthy := true
+	for i := range results {
+		result := &results[i]
+		if last, ok := lastHealthErrors[result.Backend]; ok {
+			result.LastError, result.LastErrorAt = last.message, &last.at
+		}
+		result.Critical = criticalBackends == nil || criticalBackends[strings.ToLower(result.Backend)]
+		if result.Critical && result.Status == HealthDown {
+			healthy = false
+		}
+	}
+	return results, healthy
+}
+
+//checkHealth runs the health check, giving up after healthCheckTimeout
+func checkHealth(checker backend.HealthChecker) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- checker.CheckHealth()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(healthCheckTimeout):
+		return fmt.Errorf("health check timed out after %s", healthCheckTimeout)
+	}
+}
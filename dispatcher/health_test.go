@@ -0,0 +1,64 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+)
+
+//checkedBackend reports the configured health
+type checkedBackend struct {
+	backend.DummyBackend
+	name  string
+	err   error
+	delay time.Duration
+}
+
+func (be *checkedBackend) Name() string { return be.name }
+func (be *checkedBackend) CheckHealth() error {
+	time.Sleep(be.delay)
+	return be.err
+}
+
+func Test_CheckHealth(t *testing.T) {
+	up := &checkedBackend{name: "Up"}
+	down := &checkedBackend{name: "Down", err: errors.New("unreachable")}
+	slow := &checkedBackend{name: "Slow", delay: time.Second}
+	unchecked := &backend.DummyBackend{}
+	backendconfig.RegisteredBackends = []backend.Plugin{up, down, slow, unchecked}
+	timeout := healthCheckTimeout
+	healthCheckTimeout = 50 * time.Millisecond
+	defer func() {
+		backendconfig.RegisteredBackends = nil
+		healthCheckTimeout = timeout
+		ConfigureHealth(nil)
+	}()
+
+	ConfigureHealth([]string{"up"})
+	results, healthy := CheckHealth()
+	if !healthy {
+		fmt.Printf("Expected non critical backends not to fail the health check, got: %+v\n", results)
+		t.FailNow()
+	}
+	expected := []string{HealthUp, HealthDown, HealthDown, HealthUnknown}
+	for i, result := range results {
+		if result.Status != expected[i] {
+			fmt.Printf("Expected backend '%s' to be %s, got: %s\n", result.Backend, expected[i], result.Status)
+			t.FailNow()
+		}
+	}
+	if results[1].LastError != "unreachable" || results[1].LastErrorAt == nil || results[0].LastError != "" {
+		fmt.Printf("Expected the last error of the failed backend only, got: %+v\n", results)
+		t.FailNow()
+	}
+
+	ConfigureHealth(nil)
+	if _, healthy := CheckHealth(); healthy {
+		fmt.Println("Expected all backends to be critical by default")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,157 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/journal"
+)
+
+//standbyEntry is an event a follower accepted, but did not dispatch
+type standbyEntry struct {
+	id       uint64
+	key      string
+	payload  []byte
+	names    []string
+	handlers map[string]func() error
+	accepted time.Time
+}
+
+// following, the takeover window, the leader's watermark and the standby entries are guarded
+// by dispatchMutex, following is read atomically outside of it
+var (
+	following  int32
+	takeover   time.Duration
+	leaderMark time.Time
+	standby    []standbyEntry
+)
+
+//Follow makes this instance a follower. Followers journal the events they accept instead of dispatching
+//them, until the leader's watermark shows it handled them, see Followed. The events which are left are
+//dispatched once the instance becomes leader, as the former leader might have failed before handling them.
+//The takeover window allows for events reaching the instances at different times.
+func Follow(window time.Duration) {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+	takeover = window
+	if atomic.SwapInt32(&following, 1) == 0 {
+		glog.Infof("following, events are not dispatched to the backends")
+	}
+}
+
+//Lead makes this instance the leader and dispatches the events the former leader might not have handled
+func Lead() {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+	if atomic.SwapInt32(&following, 0) == 0 {
+		return
+	}
+	pruneStandby()
+	glog.Infof("leading, dispatching %d events accepted while following", len(standby))
+	for _, entry := range standby {
+		for _, name := range entry.names {
+			inflight.Add(entry.accepted, 1)
+			// the events were accepted before, they must not be rejected now
+			queueFor(name).accept(task{id: entry.id, key: entry.key, payload: entry.payload, handle: entry.handlers[name], accepted: entry.accepted})
+		}
+	}
+	standby = nil
+}
+
+//SetLeader calls Lead or Follow, the takeover window is kept
+func SetLeader(leading bool) {
+	if leading {
+		Lead()
+		return
+	}
+	dispatchMutex.Lock()
+	window := takeover
+	dispatchMutex.Unlock()
+	Follow(window)
+}
+
+//Leading reports whether this instance dispatches events to the backends
+func Leading() bool {
+	return atomic.LoadInt32(&following) == 0
+}
+
+//standBy keeps the event until the instance becomes leader, it must be called with dispatchMutex held
+func standBy(entry standbyEntry) {
+	pruneStandby()
+	standby = append(standby, entry)
+}
+
+//Watermark returns the time before which this instance handled all events it accepted,
+//the leader publishes it for the followers
+func Watermark() time.Time {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+	if oldest, ok := inflight.oldest(); ok {
+		return oldest
+	}
+	return time.Now()
+}
+
+//Followed lets a follower forget the events the leader handled according to its watermark
+func Followed(mark time.Time) {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+	if mark.After(leaderMark) {
+		leaderMark = mark
+	}
+	pruneStandby()
+}
+
+//pruneStandby drops the events accepted before the leader's watermark, less the takeover window.
+//The leader handled them, so they are completed in the journal. Without a watermark it is unknown
+//whether any leader handled them, so they are kept. It must be called with dispatchMutex held.
+func pruneStandby() {
+	if leaderMark.IsZero() {
+		return
+	}
+	cutoff := leaderMark.Add(-takeover)
+	i := 0
+	for ; i < len(standby) && standby[i].accepted.Before(cutoff); i++ {
+		for _, name := range standby[i].names {
+			complete(standby[i].id, name)
+		}
+	}
+	standby = standby[i:]
+}
+
+//standByRecovered keeps recovered journal entries until the instance becomes leader. Their age is
+//unknown, so they count as accepted now. It must be called with dispatchMutex held.
+func standByRecovered(entry journal.Entry, key string, handlers map[string]func() error) {
+	var names []string
+	for _, name := range entry.Backends {
+		if handlers[name] != nil {
+			names = append(names, name)
+		}
+	}
+	standBy(standbyEntry{id: entry.ID, key: key, payload: entry.Payload, names: names, handlers: handlers, accepted: time.Now()})
+}
+
+//ErrFollowing is returned by operations only the leader may run
+var ErrFollowing = fmt.Errorf("this instance is a follower, only the leader modifies backends")
+
+//LeaderAspect reports whether this instance is leading for the monitoring endpoint
+type LeaderAspect struct{}
+
+//GetStats returns the leadership and the number of events waiting for a takeover
+func (a *LeaderAspect) GetStats() interface{} {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+	return map[string]interface{}{"leading": Leading(), "standby": len(standby)}
+}
+
+//Name returns the name of the aspect
+func (a *LeaderAspect) Name() string {
+	return "Leader"
+}
+
+//InRoot returns false, the stats are served at /Leader
+func (a *LeaderAspect) InRoot() bool {
+	return false
+}
@@ -0,0 +1,86 @@
+package dispatcher
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+)
+
+func Test_Follow(t *testing.T) {
+	be := &recordingBackend{}
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	Follow(time.Hour)
+	defer Lead()
+
+	statusUpdate := func(taskID string) {
+		payload := []byte(fmt.Sprintf(`{"eventType": "status_update_event", "appId": "/my-app", "taskId": "%s", "taskStatus": "TASK_RUNNING"}`, taskID))
+		_, event, err := Decode(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outcomes, err := DispatchAndWait(payload, event, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outcomes) != 1 || outcomes[0].Status != OutcomeStandby {
+			fmt.Printf("Expected the follower to accept the event, got: %+v\n", outcomes)
+			t.FailNow()
+		}
+	}
+	dispatchMutex.Lock()
+	leaderMark = time.Time{}
+	dispatchMutex.Unlock()
+	statusUpdate("1")
+	dispatchMutex.Lock()
+	standby[0].accepted = time.Now().Add(-2 * time.Hour)
+	dispatchMutex.Unlock()
+	// without a watermark, it is unknown whether a leader handled the first event
+	statusUpdate("2")
+	dispatchMutex.Lock()
+	kept := len(standby)
+	dispatchMutex.Unlock()
+	if kept != 2 {
+		fmt.Printf("Expected the follower to keep all events without a watermark, got: %d\n", kept)
+		t.FailNow()
+	}
+	// the leader handled the first event
+	Followed(time.Now())
+	if Leading() || len(be.tasks) != 0 {
+		fmt.Printf("Expected the follower not to dispatch events, got: %v\n", be.tasks)
+		t.FailNow()
+	}
+	payload, event := statusUpdateEvent("3")
+	if err := DispatchTo(payload, event, ""); err != ErrFollowing {
+		fmt.Printf("Expected a follower not to dispatch on purpose, got: %v\n", err)
+		t.FailNow()
+	}
+	if _, err := Replay(bytes.NewReader(payload), "", 0); err != ErrFollowing {
+		fmt.Printf("Expected a follower not to replay, got: %v\n", err)
+		t.FailNow()
+	}
+
+	Lead()
+	Wait()
+	if !Leading() || len(be.tasks) != 1 || be.tasks[0] != "2" {
+		fmt.Printf("Expected the new leader to dispatch the event within the takeover window, got: %v\n", be.tasks)
+		t.FailNow()
+	}
+	if _, err := Reconcile(""); err != nil && err == ErrFollowing {
+		fmt.Println("Expected the leader to reconcile")
+		t.FailNow()
+	}
+	SetLeader(false)
+	if _, err := Reconcile(""); err != ErrFollowing {
+		fmt.Printf("Expected a follower not to reconcile, got: %v\n", err)
+		t.FailNow()
+	}
+}
+
+func statusUpdateEvent(taskID string) ([]byte, interface{}) {
+	return statusUpdate(taskID)
+}
@@ -0,0 +1,88 @@
+package dispatcher
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// statuses of an outcome
+const (
+	OutcomeHandled = "handled"
+	OutcomeFailed  = "failed"
+	OutcomeDropped = "dropped"
+	OutcomePending = "pending"
+	OutcomeStandby = "standby" // accepted by a follower, the leader handles it
+)
+
+//Outcome describes how a backend handled an event
+type Outcome struct {
+	Backend    string `json:"backend"`
+	Status     string `json:"status"`
+	Attempts   int    `json:"attempts"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+//tracker collects the outcomes of an event for all backends it was dispatched to
+type tracker struct {
+	mutex    sync.Mutex
+	outcomes map[string]Outcome
+	waiting  int
+	done     chan struct{}
+}
+
+func newTracker() *tracker {
+	return &tracker{outcomes: make(map[string]Outcome), done: make(chan struct{})}
+}
+
+//expect registers the backends the event is dispatched to, before any of them can report
+func (t *tracker) expect(names []string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, name := range names {
+		t.outcomes[name] = Outcome{Backend: name, Status: OutcomePending}
+	}
+	t.waiting = len(names)
+	if t.waiting == 0 {
+		close(t.done)
+	}
+}
+
+//report records the outcome of a backend
+func (t *tracker) report(outcome Outcome) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.outcomes[outcome.Backend] = outcome
+	t.waiting--
+	if t.waiting == 0 {
+		close(t.done)
+	}
+}
+
+//wait blocks until all backends reported or the timeout passed and returns the outcomes by backend name
+func (t *tracker) wait(timeout time.Duration) []Outcome {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-t.done:
+	case <-timer.C:
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	outcomes := make([]Outcome, 0, len(t.outcomes))
+	for _, outcome := range t.outcomes {
+		outcomes = append(outcomes, outcome)
+	}
+	sort.Sort(byBackend(outcomes))
+	return outcomes
+}
+
+type byBackend []Outcome
+
+func (o byBackend) Len() int           { return len(o) }
+func (o byBackend) Swap(a, b int)      { o[a], o[b] = o[b], o[a] }
+func (o byBackend) Less(a, b int) bool { return o[a].Backend < o[b].Backend }
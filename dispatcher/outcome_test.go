@@ -0,0 +1,42 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+func Test_DispatchAndWait(t *testing.T) {
+	slow := newBlockingBackend("Slow")
+	backendconfig.RegisteredBackends = []backend.Plugin{&recordingBackend{}, &outageBackend{down: true}, slow}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureRetries(map[string]conf.Retry{"outage": {MaxAttempts: 1}})
+
+	payload, event := statusUpdate("1")
+	outcomes, err := DispatchAndWait(payload, event, 100*time.Millisecond)
+	close(slow.release)
+	Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Outcome{
+		{Backend: "Outage", Status: OutcomeFailed, Attempts: 1, Error: "backend unavailable"},
+		{Backend: "Recording", Status: OutcomeHandled, Attempts: 1},
+		{Backend: "Slow", Status: OutcomePending},
+	}
+	if len(outcomes) != len(expected) {
+		fmt.Printf("Expected %d outcomes, got: %+v\n", len(expected), outcomes)
+		t.FailNow()
+	}
+	for i, outcome := range outcomes {
+		outcome.DurationMs = 0
+		if outcome != expected[i] {
+			fmt.Printf("Expected: %+v, got: %+v\n", expected[i], outcome)
+			t.FailNow()
+		}
+	}
+}
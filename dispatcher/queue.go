@@ -0,0 +1,318 @@
+package dispatcher
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+// overflow policies of a backend queue
+const (
+	OverflowBlock      = "block"
+	OverflowDropOldest = "drop-oldest"
+	OverflowReject     = "reject"
+)
+
+// defaults for backends without queue settings
+const (
+	defaultQueueSize = 1000
+	defaultWorkers   = 4
+)
+
+//QueueFullError is returned if a backend with the reject policy can not take more events
+type QueueFullError struct {
+	Backend string
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("queue of backend '%s' is full", e.Backend)
+}
+
+//task is an event waiting in a backend queue
+type task struct {
+	id       uint64
+	key      string // events with the same key are handled in order
+	payload  []byte
+	handle   func() error
+	tracker  *tracker  // nil unless someone waits for the outcome
+	accepted time.Time // when the event was accepted, see Watermark
+}
+
+//queue is the bounded queue of a backend, worked off by a fixed number of workers.
+//Every worker has its own shard of the queue and all events of an app go to the same
+//shard, so a backend sees the events of one app in the order Marathon sent them.
+type queue struct {
+	name     string
+	overflow string
+	workers  int
+	shards   []chan task
+	dropped  int64
+	rejected int64
+	// events not fitting into their shard wait in its backlog, see enqueue
+	backlogMutex sync.Mutex
+	backlogs     [][]task
+	feeding      []bool
+	// space wakes up pushes waiting for a full shard
+	space *sync.Cond
+}
+
+var (
+	queueSettings map[string]conf.Queue
+	queues        = make(map[string]*queue)
+	queuesMutex   sync.Mutex
+)
+
+//ConfigureQueues sets the queue settings per backend name. The "default" entry applies to all
+//backends without own settings. Queues which are already running keep their settings.
+func ConfigureQueues(settings map[string]conf.Queue) {
+	queuesMutex.Lock()
+	defer queuesMutex.Unlock()
+	queueSettings = make(map[string]conf.Queue)
+	for name, setting := range settings {
+		// viper lower cases all keys
+		queueSettings[strings.ToLower(name)] = setting
+	}
+}
+
+//queueFor returns the queue of the backend, starting it on first use
+func queueFor(name string) *queue {
+	queuesMutex.Lock()
+	defer queuesMutex.Unlock()
+	if q, ok := queues[name]; ok {
+		return q
+	}
+	setting, ok := queueSettings[strings.ToLower(name)]
+	if !ok {
+		setting = queueSettings["default"]
+	}
+	q := &queue{name: name, overflow: setting.Overflow, workers: setting.Workers}
+	if setting.Size <= 0 {
+		setting.Size = defaultQueueSize
+	}
+	if q.workers <= 0 {
+		q.workers = defaultWorkers
+	}
+	switch q.overflow {
+	case OverflowBlock, OverflowDropOldest, OverflowReject:
+	default:
+		if q.overflow != "" {
+			glog.Warningf("unknown overflow policy '%s' for backend '%s', using '%s'", q.overflow, name, OverflowBlock)
+		}
+		q.overflow = OverflowBlock
+	}
+	q.backlogs = make([][]task, q.workers)
+	q.feeding = make([]bool, q.workers)
+	q.space = sync.NewCond(&q.backlogMutex)
+	// the size is shared by all shards, rounded up so no shard is unbuffered
+	shardSize := (setting.Size + q.workers - 1) / q.workers
+	for i := 0; i < q.workers; i++ {
+		tasks := make(chan task, shardSize)
+		q.shards = append(q.shards, tasks)
+		go q.work(tasks)
+	}
+	queues[name] = q
+	return q
+}
+
+//work handles the events of a shard one after another until it is closed.
+//It waits while the backend is paused and drops the events while it is disabled.
+func (q *queue) work(tasks chan task) {
+	for {
+		// paused backends leave their events in the queue, so its depth shows them
+		awaitActive(q.name)
+		t, ok := <-tasks
+		if !ok {
+			return
+		}
+		q.backlogMutex.Lock()
+		q.space.Broadcast()
+		q.backlogMutex.Unlock()
+		if awaitActive(q.name) {
+			q.drop(t, "backend is disabled")
+			continue
+		}
+		run(t, q.name)
+	}
+}
+
+func (q *queue) shardIndex(key string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(len(q.shards)))
+}
+
+//depth returns the number of waiting events
+func (q *queue) depth() (depth int, capacity int) {
+	for _, tasks := range q.shards {
+		depth += len(tasks)
+		capacity += cap(tasks)
+	}
+	q.backlogMutex.Lock()
+	defer q.backlogMutex.Unlock()
+	for _, backlog := range q.backlogs {
+		depth += len(backlog)
+	}
+	return depth, capacity
+}
+
+//full reports whether the shard and its backlog hold as many events as the shard can take.
+//Must be called with the backlogMutex held.
+func (q *queue) full(i int) bool {
+	return len(q.shards[i])+len(q.backlogs[i]) >= cap(q.shards[i])
+}
+
+//push enqueues the task according to the overflow policy of the queue. With the block policy, it waits for
+//free space if wait is true and reports false instead otherwise. A paused backend never holds up the push,
+//its events wait in the backlog of the shard until it is resumed.
+func (q *queue) push(t task, wait bool) (bool, error) {
+	i := q.shardIndex(t.key)
+	q.backlogMutex.Lock()
+	defer q.backlogMutex.Unlock()
+	if q.full(i) {
+		switch q.overflow {
+		case OverflowReject:
+			atomic.AddInt64(&q.rejected, 1)
+			return false, &QueueFullError{Backend: q.name}
+		case OverflowDropOldest:
+			q.dropOldest(i)
+		default:
+			for q.full(i) && backendState(q.name) == BackendActive {
+				if !wait {
+					return false, nil
+				}
+				q.space.Wait()
+			}
+		}
+	}
+	q.enqueue(i, t)
+	return true, nil
+}
+
+//dropOldest drops the oldest event of the shard. Must be called with the backlogMutex held.
+func (q *queue) dropOldest(i int) {
+	select {
+	case old := <-q.shards[i]:
+		q.drop(old, "dropped from full queue")
+		return
+	default:
+	}
+	if len(q.backlogs[i]) > 0 {
+		old := q.backlogs[i][0]
+		q.backlogs[i] = q.backlogs[i][1:]
+		q.drop(old, "dropped from full queue")
+	}
+}
+
+//accept enqueues a task which was accepted before, p.e. recovered from the journal, regardless of the
+//overflow policy and without blocking, so a paused or slow backend can not hold up the startup or a takeover.
+func (q *queue) accept(t task) {
+	i := q.shardIndex(t.key)
+	q.backlogMutex.Lock()
+	defer q.backlogMutex.Unlock()
+	q.enqueue(i, t)
+}
+
+//enqueue puts the task into the shard. If the shard is full or its backlog is not empty, the task is
+//appended to the backlog instead, which is fed into the shard in order, so later events of an app never
+//overtake earlier ones. Must be called with the backlogMutex held.
+func (q *queue) enqueue(i int, t task) {
+	if !q.feeding[i] {
+		select {
+		case q.shards[i] <- t:
+			return
+		default:
+		}
+		q.feeding[i] = true
+		go q.feed(i)
+	}
+	q.backlogs[i] = append(q.backlogs[i], t)
+}
+
+//feed moves the backlog of the shard into it as space becomes free
+func (q *queue) feed(i int) {
+	for {
+		q.backlogMutex.Lock()
+		if len(q.backlogs[i]) == 0 {
+			q.feeding[i] = false
+			q.backlogMutex.Unlock()
+			return
+		}
+		t := q.backlogs[i][0]
+		q.backlogs[i] = q.backlogs[i][1:]
+		q.backlogMutex.Unlock()
+		q.shards[i] <- t
+	}
+}
+
+//wakePushes lets the pushes waiting for a full shard check the state of their backend again
+func wakePushes() {
+	queuesMutex.Lock()
+	defer queuesMutex.Unlock()
+	for _, q := range queues {
+		q.backlogMutex.Lock()
+		q.space.Broadcast()
+		q.backlogMutex.Unlock()
+	}
+}
+
+//drop discards a task, it is marked as done so it will not be recovered from the journal
+func (q *queue) drop(t task, reason string) {
+	atomic.AddInt64(&q.dropped, 1)
+	glog.Warningf("backend '%s' dropped event %d: %s", q.name, t.id, reason)
+	complete(t.id, q.name)
+	t.tracker.report(Outcome{Backend: q.name, Status: OutcomeDropped, Error: reason})
+	inflight.Done(t.accepted)
+}
+
+//QueueStats describes the state of a backend queue
+type QueueStats struct {
+	Depth    int    `json:"depth"`
+	Capacity int    `json:"capacity"`
+	Workers  int    `json:"workers"`
+	Overflow string `json:"overflow"`
+	Dropped  int64  `json:"dropped"`
+	Rejected int64  `json:"rejected"`
+}
+
+//Queues returns the stats of all backend queues
+func Queues() map[string]QueueStats {
+	queuesMutex.Lock()
+	defer queuesMutex.Unlock()
+	stats := make(map[string]QueueStats)
+	for name, q := range queues {
+		depth, capacity := q.depth()
+		stats[name] = QueueStats{
+			Depth:    depth,
+			Capacity: capacity,
+			Workers:  q.workers,
+			Overflow: q.overflow,
+			Dropped:  atomic.LoadInt64(&q.dropped),
+			Rejected: atomic.LoadInt64(&q.rejected),
+		}
+	}
+	return stats
+}
+
+//QueueAspect exposes the queue stats on the monitoring endpoint
+type QueueAspect struct{}
+
+//GetStats returns the stats of all backend queues
+func (a *QueueAspect) GetStats() interface{} {
+	return Queues()
+}
+
+//Name returns the name of the aspect
+func (a *QueueAspect) Name() string {
+	return "Queues"
+}
+
+//InRoot returns false, the stats are served at /Queues
+func (a *QueueAspect) InRoot() bool {
+	return false
+}
@@ -0,0 +1,207 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+//blockingBackend blocks in HandleUpdate until it is released
+type blockingBackend struct {
+	backend.DummyBackend
+	name    string
+	started chan string
+	release chan struct{}
+	mutex   sync.Mutex
+	tasks   []string
+}
+
+func newBlockingBackend(name string) *blockingBackend {
+	return &blockingBackend{name: name, started: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (be *blockingBackend) Name() string { return be.name }
+func (be *blockingBackend) HandleUpdate(e backend.StatusUpdateEvent) error {
+	be.started <- e.Taskid
+	<-be.release
+	be.mutex.Lock()
+	defer be.mutex.Unlock()
+	be.tasks = append(be.tasks, e.Taskid)
+	return nil
+}
+
+func statusUpdate(taskID string) ([]byte, interface{}) {
+	payload := []byte(fmt.Sprintf(`{"eventType": "status_update_event", "appId": "/my-app", "taskId": "%s", "taskStatus": "TASK_RUNNING"}`, taskID))
+	_, event, _ := Decode(payload)
+	return payload, event
+}
+
+func Test_QueueReject(t *testing.T) {
+	be := newBlockingBackend("Rejecting")
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureQueues(map[string]conf.Queue{"rejecting": {Size: 1, Workers: 1, Overflow: OverflowReject}})
+	rejected := Queues()["Rejecting"].Rejected
+
+	if err := Dispatch(statusUpdate("1")); err != nil {
+		t.Fatal(err)
+	}
+	<-be.started
+	if err := Dispatch(statusUpdate("2")); err != nil {
+		t.Fatal(err)
+	}
+	err := Dispatch(statusUpdate("3"))
+	if _, ok := err.(*QueueFullError); !ok {
+		fmt.Printf("Expected QueueFullError, got: %v\n", err)
+		t.FailNow()
+	}
+	close(be.release)
+	if stats := Queues()["Rejecting"]; stats.Rejected-rejected != 1 {
+		fmt.Printf("Unexpected queue stats: %+v\n", stats)
+		t.FailNow()
+	}
+	Wait()
+	if len(be.tasks) != 2 {
+		fmt.Printf("Expected 2 handled events, got: %v\n", be.tasks)
+		t.FailNow()
+	}
+}
+
+func Test_QueueDropOldest(t *testing.T) {
+	be := newBlockingBackend("Dropping")
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureQueues(map[string]conf.Queue{"dropping": {Size: 1, Workers: 1, Overflow: OverflowDropOldest}})
+	dropped := Queues()["Dropping"].Dropped
+
+	Dispatch(statusUpdate("1"))
+	<-be.started
+	Dispatch(statusUpdate("2"))
+	Dispatch(statusUpdate("3"))
+	close(be.release)
+	Wait()
+	if len(be.tasks) != 2 || be.tasks[0] != "1" || be.tasks[1] != "3" {
+		fmt.Printf("Expected events 1 and 3 to be handled, got: %v\n", be.tasks)
+		t.FailNow()
+	}
+	if stats := Queues()["Dropping"]; stats.Dropped-dropped != 1 {
+		fmt.Printf("Unexpected queue stats: %+v\n", stats)
+		t.FailNow()
+	}
+}
+
+//orderBackend records the task ids per app
+type orderBackend struct {
+	backend.DummyBackend
+	mutex sync.Mutex
+	tasks map[string][]int
+}
+
+func (be *orderBackend) Name() string { return "Ordering" }
+func (be *orderBackend) HandleUpdate(e backend.StatusUpdateEvent) error {
+	var task int
+	fmt.Sscanf(e.Taskid, "%d", &task)
+	// later events of an app finish faster, so they would overtake without ordering
+	time.Sleep(time.Duration(10-task%10) * 100 * time.Microsecond)
+	be.mutex.Lock()
+	defer be.mutex.Unlock()
+	be.tasks[e.Appid] = append(be.tasks[e.Appid], task)
+	return nil
+}
+
+func Test_QueueOrdering(t *testing.T) {
+	be := &orderBackend{tasks: make(map[string][]int)}
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureQueues(map[string]conf.Queue{"ordering": {Size: 100, Workers: 8}})
+
+	apps := []string{"/a", "/b", "/c", "/d"}
+	for i := 0; i < 40; i++ {
+		payload := []byte(fmt.Sprintf(`{"eventType": "status_update_event", "appId": "%s", "taskId": "%d", "taskStatus": "TASK_RUNNING"}`, apps[i%len(apps)], i))
+		if err := Process(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Wait()
+	for _, app := range apps {
+		tasks := be.tasks[app]
+		if len(tasks) != 10 {
+			fmt.Printf("Expected 10 events for %s, got: %v\n", app, tasks)
+			t.FailNow()
+		}
+		for i := 1; i < len(tasks); i++ {
+			if tasks[i] < tasks[i-1] {
+				fmt.Printf("Events of %s are out of order: %v\n", app, tasks)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func Test_QueueRejectPerBackend(t *testing.T) {
+	full := newBlockingBackend("RejectingOne")
+	other := newBlockingBackend("TakingAll")
+	close(other.release)
+	backendconfig.RegisteredBackends = []backend.Plugin{full, other}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureQueues(map[string]conf.Queue{"rejectingone": {Size: 1, Workers: 1, Overflow: OverflowReject}})
+
+	for _, taskID := range []string{"1", "2", "3"} {
+		if err := Dispatch(statusUpdate(taskID)); err != nil {
+			fmt.Printf("Expected a full queue not to refuse event %s for the other backends, got: %s\n", taskID, err)
+			t.FailNow()
+		}
+		if taskID == "1" {
+			<-full.started
+		}
+	}
+	close(full.release)
+	Wait()
+	if len(full.tasks) != 2 || len(other.tasks) != 3 {
+		fmt.Printf("Expected 2 and 3 handled events, got: %v and %v\n", full.tasks, other.tasks)
+		t.FailNow()
+	}
+}
+
+func Test_QueueBlockOtherBackends(t *testing.T) {
+	full := newBlockingBackend("BlockingOne")
+	other := newBlockingBackend("Unblocked")
+	close(other.release)
+	backendconfig.RegisteredBackends = []backend.Plugin{full, other}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureQueues(map[string]conf.Queue{"blockingone": {Size: 1, Workers: 1}})
+
+	DispatchTo(statusUpdateFor("1", "BlockingOne"))
+	<-full.started
+	DispatchTo(statusUpdateFor("2", "BlockingOne"))
+	blocked := make(chan error)
+	go func() { blocked <- DispatchTo(statusUpdateFor("3", "BlockingOne")) }()
+
+	// the full queue holds up the event for its backend, but not the others
+	done := make(chan error)
+	go func() { done <- DispatchTo(statusUpdateFor("4", "Unblocked")) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		fmt.Println("Expected a full queue not to block the other backends")
+		t.FailNow()
+	}
+	close(full.release)
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+}
+
+func statusUpdateFor(taskID, backendName string) ([]byte, interface{}, string) {
+	payload, event := statusUpdate(taskID)
+	return payload, event, backendName
+}
@@ -0,0 +1,158 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+	"github.com/zalando-techmonkeys/howler/state"
+)
+
+//ReconcileResult describes the changes a backend made while reconciling
+type ReconcileResult struct {
+	Backend    string           `json:"backend"`
+	Started    time.Time        `json:"started"`
+	DurationMs int64            `json:"durationMs"`
+	Changes    []backend.Change `json:"changes"`
+	Error      string           `json:"error,omitempty"`
+}
+
+var (
+	// refreshState loads the cluster state from Marathon before reconciling
+	refreshState   func() error
+	reconcileMutex sync.Mutex
+	lastReconciled = make(map[string]ReconcileResult)
+)
+
+//UseReconciliation enables Reconcile. It calls refresh first, so backends are reconciled against Marathon
+//and not against a state which might have missed events as well.
+func UseReconciliation(refresh func() error) {
+	reconcileMutex.Lock()
+	defer reconcileMutex.Unlock()
+	refreshState = refresh
+}
+
+//ReconcileEvery reconciles all backends every interval until stop is closed, followers skip it
+func ReconcileEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !Leading() {
+				continue
+			}
+			if _, err := Reconcile(""); err != nil {
+				glog.Errorf("unable to reconcile backends: %s", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+//Reconcile lets the named backend, or all backends implementing backend.Reconciler if the name is
+//empty, compare their resources with the cluster state. Every backend gets the apps and tasks its routing
+//rules send events for and, to keep resources of tasks excluded by routing, all of them. Only the leader
+//reconciles, paused and disabled backends are skipped.
+func Reconcile(backendName string) ([]ReconcileResult, error) {
+	if !Leading() {
+		return nil, ErrFollowing
+	}
+	reconcileMutex.Lock()
+	defer reconcileMutex.Unlock()
+	if backendName != "" && backendState(backendName) != BackendActive {
+		return nil, fmt.Errorf("backend '%s' is %s", backendName, backendState(backendName))
+	}
+	var reconcilers []backend.Plugin
+	for _, be := range backendconfig.RegisteredBackends {
+		if backendName != "" && be.Name() != backendName {
+			continue
+		}
+		// paused and disabled backends must not touch their resources
+		if backendState(be.Name()) != BackendActive {
+			continue
+		}
+		if _, ok := be.(backend.Reconciler); ok {
+			reconcilers = append(reconcilers, be)
+		}
+	}
+	if backendName != "" && len(reconcilers) == 0 {
+		return nil, fmt.Errorf("backend '%s' is not registered or can not be reconciled", backendName)
+	}
+	// a state built from events only lacks everything which happened before Howler started,
+	// reconciling against it would remove resources of tasks which are still running
+	if refreshState == nil {
+		return nil, fmt.Errorf("reconciliation needs a Marathon endpoint to load the cluster state from")
+	}
+	if err := refreshState(); err != nil {
+		return nil, fmt.Errorf("unable to refresh cluster state: %s", err)
+	}
+
+	cluster := state.Cluster.Snapshot()
+	results := []ReconcileResult{}
+	for _, be := range reconcilers {
+		result := ReconcileResult{Backend: be.Name(), Started: time.Now().UTC()}
+		changes, err := be.(backend.Reconciler).Reconcile(routedSnapshot(be.Name(), cluster), cluster)
+		result.DurationMs = int64(time.Since(result.Started) / time.Millisecond)
+		result.Changes = changes
+		if result.Changes == nil {
+			result.Changes = []backend.Change{}
+		}
+		if err != nil {
+			result.Error = err.Error()
+			glog.Errorf("unable to reconcile backend '%s': %s", be.Name(), err)
+		}
+		glog.Infof("reconciled backend '%s' with %d changes", be.Name(), len(result.Changes))
+		lastReconciled[be.Name()] = result
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+//LastReconciliation returns the result of the last reconciliation of every backend
+func LastReconciliation() []ReconcileResult {
+	reconcileMutex.Lock()
+	defer reconcileMutex.Unlock()
+	results := []ReconcileResult{}
+	for _, be := range backendconfig.RegisteredBackends {
+		if result, ok := lastReconciled[be.Name()]; ok {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+//routedSnapshot reduces the snapshot to the apps and tasks whose events are routed to the backend
+func routedSnapshot(name string, cluster state.Snapshot) state.Snapshot {
+	routedApps := make(map[string]bool)
+	routedSnapshot := state.Snapshot{Apps: []state.App{}, Tasks: []state.Task{}, Deployments: cluster.Deployments}
+	for _, task := range cluster.Tasks {
+		e := &backend.StatusUpdateEvent{
+			Event:      backend.Event{Eventtype: "status_update_event"},
+			Taskid:     task.ID,
+			Taskstatus: task.Status,
+			Appid:      task.AppID,
+			Host:       task.Host,
+		}
+		if app, ok := state.Cluster.App(task.AppID); ok {
+			e.App = &backend.App{ID: app.ID, Labels: app.Labels}
+		}
+		if routed(name, e) {
+			routedSnapshot.Tasks = append(routedSnapshot.Tasks, task)
+			routedApps[task.AppID] = true
+		}
+	}
+	for _, app := range cluster.Apps {
+		e := &backend.APIRequestEvent{Event: backend.Event{Eventtype: "api_post_event"}}
+		e.Appdefinition.ID = app.ID
+		e.Appdefinition.Labels = app.Labels
+		if routedApps[app.ID] || routed(name, e) {
+			routedSnapshot.Apps = append(routedSnapshot.Apps, app)
+		}
+	}
+	return routedSnapshot
+}
@@ -0,0 +1,83 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+	"github.com/zalando-techmonkeys/howler/conf"
+	"github.com/zalando-techmonkeys/howler/state"
+)
+
+//reconcilingBackend keeps one resource per running task
+type reconcilingBackend struct {
+	backend.DummyBackend
+	resources map[string]bool
+}
+
+func (be *reconcilingBackend) Name() string { return "Reconciling" }
+func (be *reconcilingBackend) Reconcile(cluster state.Snapshot, _ state.Snapshot) ([]backend.Change, error) {
+	var changes []backend.Change
+	running := make(map[string]bool)
+	for _, task := range cluster.Tasks {
+		running[task.ID] = true
+		if !be.resources[task.ID] {
+			be.resources[task.ID] = true
+			changes = append(changes, backend.Change{Action: backend.ChangeAdded, Resource: task.ID})
+		}
+	}
+	for id := range be.resources {
+		if !running[id] {
+			delete(be.resources, id)
+			changes = append(changes, backend.Change{Action: backend.ChangeRemoved, Resource: id})
+		}
+	}
+	return changes, nil
+}
+
+func Test_Reconcile(t *testing.T) {
+	be := &reconcilingBackend{resources: map[string]bool{"stale": true, "public-1": true}}
+	backendconfig.RegisteredBackends = []backend.Plugin{be, &recordingBackend{}}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureRoutes(map[string][]conf.Route{"reconciling": {{AppID: "/public/*"}}})
+	defer ConfigureRoutes(nil)
+	defer state.Cluster.Bootstrap(nil, nil)
+
+	if _, err := Reconcile(""); err == nil {
+		fmt.Println("Reconciliation without Marathon state is accepted")
+		t.FailNow()
+	}
+	UseReconciliation(func() error {
+		state.Cluster.Bootstrap(
+			[]state.App{{ID: "/public/web"}, {ID: "/internal/db"}},
+			[]state.Task{
+				{ID: "public-1", AppID: "/public/web", Status: "TASK_RUNNING"},
+				{ID: "public-2", AppID: "/public/web", Status: "TASK_RUNNING"},
+				{ID: "internal-1", AppID: "/internal/db", Status: "TASK_RUNNING"},
+			})
+		return nil
+	})
+	defer UseReconciliation(nil)
+
+	results, err := Reconcile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Backend != "Reconciling" || len(results[0].Changes) != 2 {
+		fmt.Printf("Expected 2 changes of the reconciling backend, got: %+v\n", results)
+		t.FailNow()
+	}
+	if !be.resources["public-2"] || be.resources["stale"] || be.resources["internal-1"] {
+		fmt.Printf("Expected resources of routed running tasks only, got: %v\n", be.resources)
+		t.FailNow()
+	}
+	if last := LastReconciliation(); len(last) != 1 || len(last[0].Changes) != 2 {
+		fmt.Printf("Unexpected last reconciliation: %+v\n", last)
+		t.FailNow()
+	}
+	if _, err := Reconcile("Recording"); err == nil {
+		fmt.Println("Reconciliation of a backend without Reconciler is accepted")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,64 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+//reloadMutex serializes reloads
+var reloadMutex sync.Mutex
+
+//Reload applies a reloaded configuration, see conf.Reload: the backend configs, the routing rules, the retry
+//policies and the deduplication window. Nothing is applied if a routing rule is invalid or a backend refuses
+//its config. Queued events are kept, events being handled finish with the former config.
+func Reload(config *conf.Config) error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	compiled, err := compileRoutes(config.Routes)
+	if err != nil {
+		return fmt.Errorf("invalid routes: %s", err)
+	}
+	for _, be := range backendconfig.RegisteredBackends {
+		if reloadable, ok := be.(backend.Reloadable); ok {
+			if err := reloadable.CheckConfig(config); err != nil {
+				return fmt.Errorf("invalid config of backend '%s': %s", be.Name(), err)
+			}
+		}
+	}
+
+	conf.Use(config)
+	for _, be := range backendconfig.RegisteredBackends {
+		if reloadable, ok := be.(backend.Reloadable); ok {
+			reloadable.UseConfig(config)
+		}
+	}
+	routesMutex.Lock()
+	routes = compiled
+	routesMutex.Unlock()
+	ConfigureRetries(config.Retries)
+	// reconfiguring forgets the transitions seen, so duplicates could slip through
+	window := time.Duration(config.DedupWindow) * time.Second
+	deduplication.mutex.Lock()
+	changed := deduplication.window != window
+	deduplication.mutex.Unlock()
+	if changed {
+		ConfigureDeduplication(window)
+	}
+	glog.Infof("reloaded configuration")
+	return nil
+}
+
+//ReloadConfig reads the configuration again and applies it with Reload
+func ReloadConfig() error {
+	config, err := conf.Reload()
+	if err != nil {
+		return err
+	}
+	return Reload(config)
+}
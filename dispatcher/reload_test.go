@@ -0,0 +1,67 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+//reloadableBackend uses the endpoint of its config, an empty one is refused
+type reloadableBackend struct {
+	backend.DummyBackend
+	endpoint string
+}
+
+func (be *reloadableBackend) Name() string { return "Reloadable" }
+func (be *reloadableBackend) CheckConfig(config *conf.Config) error {
+	if config.Backends["reloadable"]["endpoint"] == "" {
+		return fmt.Errorf("endpoint is empty")
+	}
+	return nil
+}
+func (be *reloadableBackend) UseConfig(config *conf.Config) {
+	be.endpoint = config.Backends["reloadable"]["endpoint"]
+}
+
+func Test_Reload(t *testing.T) {
+	be := &reloadableBackend{endpoint: "http://old"}
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() {
+		backendconfig.RegisteredBackends = nil
+		ConfigureRoutes(nil)
+	}()
+	running := &backend.StatusUpdateEvent{Event: backend.Event{Eventtype: "status_update_event"}, Appid: "/public/shop", Taskstatus: "TASK_RUNNING"}
+
+	invalid := &conf.Config{
+		Backends: map[string]map[string]string{"reloadable": {"endpoint": "http://new"}},
+		Routes:   map[string][]conf.Route{"Reloadable": {{AppIDRegex: "("}}},
+	}
+	if err := Reload(invalid); err == nil {
+		fmt.Println("Expected invalid routes to be refused")
+		t.FailNow()
+	}
+	refused := &conf.Config{Routes: map[string][]conf.Route{"Reloadable": {{AppID: "/internal/*"}}}}
+	if err := Reload(refused); err == nil {
+		fmt.Println("Expected a config refused by a backend to be refused")
+		t.FailNow()
+	}
+	if be.endpoint != "http://old" || !routed("Reloadable", running) {
+		fmt.Printf("Expected nothing of a refused config to be applied, got endpoint %s\n", be.endpoint)
+		t.FailNow()
+	}
+
+	valid := &conf.Config{
+		Backends: map[string]map[string]string{"reloadable": {"endpoint": "http://new"}},
+		Routes:   map[string][]conf.Route{"Reloadable": {{AppID: "/internal/*"}}},
+	}
+	if err := Reload(valid); err != nil {
+		t.Fatal(err)
+	}
+	if be.endpoint != "http://new" || routed("Reloadable", running) || conf.New() != valid {
+		fmt.Printf("Expected the reloaded config to be applied, got endpoint %s\n", be.endpoint)
+		t.FailNow()
+	}
+}
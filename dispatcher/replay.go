@@ -0,0 +1,75 @@
+package dispatcher
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+//MaxReplayRate is the highest rate a replay is throttled to, higher rates are capped
+const MaxReplayRate = 10000
+
+//ReplayFailure describes a line of a capture which could not be replayed
+type ReplayFailure struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+//ReplayResult summarizes a replay
+type ReplayResult struct {
+	Replayed int             `json:"replayed"`
+	Failed   []ReplayFailure `json:"failed"`
+}
+
+//Replay pushes the events of a JSONL capture (one Marathon event per line) through the dispatcher.
+//Events are only dispatched to backendName, if it is not empty, and at most rate events per second
+//are replayed, if rate is greater than zero, up to MaxReplayRate. Only the leader replays, followers get ErrFollowing.
+func Replay(capture io.Reader, backendName string, rate int) (ReplayResult, error) {
+	result := ReplayResult{Failed: []ReplayFailure{}}
+	if !Leading() {
+		return result, ErrFollowing
+	}
+	if backendName != "" && lookup(backendName) == nil {
+		return result, fmt.Errorf("backend '%s' is not registered", backendName)
+	}
+	var throttle <-chan time.Time
+	if rate > MaxReplayRate {
+		rate = MaxReplayRate
+	}
+	if rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	scanner := bufio.NewScanner(capture)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		payload := bytes.TrimSpace(scanner.Bytes())
+		if len(payload) == 0 {
+			continue
+		}
+		// the scanner reuses its buffer, but the payload is kept by journal and backends
+		payload = append([]byte(nil), payload...)
+		if throttle != nil {
+			<-throttle
+		}
+		_, event, err := Decode(payload)
+		if err == nil {
+			err = DispatchTo(payload, event, backendName)
+		}
+		if err != nil {
+			glog.Errorf("unable to replay line %d: %s", line, err)
+			result.Failed = append(result.Failed, ReplayFailure{Line: line, Error: err.Error()})
+			continue
+		}
+		result.Replayed++
+	}
+	return result, scanner.Err()
+}
@@ -0,0 +1,79 @@
+package dispatcher
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+// defaults for backends without retry settings
+const (
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+	defaultMaxBackoff  = time.Minute
+)
+
+//retryPolicy decides how often and when a failed event is handed to a backend again
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+var (
+	retrySettings map[string]conf.Retry
+	retryMutex    sync.Mutex
+)
+
+//ConfigureRetries sets the retry settings per backend name. The "default" entry applies to all
+//backends without own settings.
+func ConfigureRetries(settings map[string]conf.Retry) {
+	retryMutex.Lock()
+	defer retryMutex.Unlock()
+	retrySettings = make(map[string]conf.Retry)
+	for name, setting := range settings {
+		// viper lower cases all keys
+		retrySettings[strings.ToLower(name)] = setting
+	}
+}
+
+//retryFor returns the retry policy of the backend
+func retryFor(name string) retryPolicy {
+	retryMutex.Lock()
+	setting, ok := retrySettings[strings.ToLower(name)]
+	if !ok {
+		setting = retrySettings["default"]
+	}
+	retryMutex.Unlock()
+	policy := retryPolicy{
+		maxAttempts: setting.MaxAttempts,
+		backoff:     time.Duration(setting.Backoff) * time.Millisecond,
+		maxBackoff:  time.Duration(setting.MaxBackoff) * time.Millisecond,
+	}
+	if policy.maxAttempts <= 0 {
+		policy.maxAttempts = defaultMaxAttempts
+	}
+	if policy.backoff <= 0 {
+		policy.backoff = defaultBackoff
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = defaultMaxBackoff
+	}
+	return policy
+}
+
+//delay returns the exponential backoff before the next attempt, with up to 50% jitter
+//so failing events of many apps do not hit the backend at the same time again
+func (p retryPolicy) delay(attempt int) time.Duration {
+	delay := p.backoff
+	for i := 1; i < attempt && delay < p.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.maxBackoff {
+		delay = p.maxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
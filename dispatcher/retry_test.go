@@ -0,0 +1,84 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+//flakyBackend fails for the configured number of attempts per task
+type flakyBackend struct {
+	backend.DummyBackend
+	mutex    sync.Mutex
+	failures map[string]int
+	attempts map[string]int
+}
+
+func (be *flakyBackend) Name() string { return "Flaky" }
+func (be *flakyBackend) HandleUpdate(e backend.StatusUpdateEvent) error {
+	be.mutex.Lock()
+	defer be.mutex.Unlock()
+	be.attempts[e.Taskid]++
+	if e.Taskstatus == "TASK_FAILED" {
+		return backend.Permanent(errors.New("can not handle failed tasks"))
+	}
+	if be.attempts[e.Taskid] <= be.failures[e.Taskid] {
+		return errors.New("backend unavailable")
+	}
+	return nil
+}
+
+//legacyBackend implements the void backend.Backend interface
+type legacyBackend struct {
+	handled int
+}
+
+func (be *legacyBackend) Name() string                               { return "Legacy" }
+func (be *legacyBackend) Register() error                            { return nil }
+func (be *legacyBackend) HandleCreate(e backend.APIRequestEvent)     {}
+func (be *legacyBackend) HandleUpdate(e backend.StatusUpdateEvent)   { be.handled++ }
+func (be *legacyBackend) HandleDestroy(e backend.AppTerminatedEvent) {}
+
+func Test_Retry(t *testing.T) {
+	be := &flakyBackend{failures: map[string]int{"1": 2, "2": 10}, attempts: make(map[string]int)}
+	legacy := &legacyBackend{}
+	backendconfig.RegisteredBackends = []backend.Plugin{be, legacy}
+	defer func() { backendconfig.RegisteredBackends = nil }()
+	ConfigureRetries(map[string]conf.Retry{"flaky": {MaxAttempts: 3, Backoff: 1, MaxBackoff: 5}})
+
+	Process([]byte(`{"eventType": "status_update_event", "appId": "/my-app", "taskId": "1", "taskStatus": "TASK_RUNNING"}`))
+	Process([]byte(`{"eventType": "status_update_event", "appId": "/my-app", "taskId": "2", "taskStatus": "TASK_RUNNING"}`))
+	Process([]byte(`{"eventType": "status_update_event", "appId": "/my-app", "taskId": "3", "taskStatus": "TASK_FAILED"}`))
+	Wait()
+	expected := map[string]int{"1": 3, "2": 3, "3": 1}
+	for task, attempts := range expected {
+		if be.attempts[task] != attempts {
+			fmt.Printf("Expected %d attempts for task %s, got: %d\n", attempts, task, be.attempts[task])
+			t.FailNow()
+		}
+	}
+	if legacy.handled != 3 {
+		fmt.Printf("Expected the legacy backend to handle 3 events, got: %d\n", legacy.handled)
+		t.FailNow()
+	}
+}
+
+func Test_retryDelay(t *testing.T) {
+	policy := retryFor("unknown")
+	if policy.maxAttempts != defaultMaxAttempts {
+		fmt.Printf("Expected default attempts, got: %d\n", policy.maxAttempts)
+		t.FailNow()
+	}
+	for attempt := 1; attempt < 20; attempt++ {
+		delay := policy.delay(attempt)
+		if delay < defaultBackoff/2 || delay > defaultMaxBackoff {
+			fmt.Printf("Delay of attempt %d out of bounds: %s\n", attempt, delay)
+			t.FailNow()
+		}
+	}
+}
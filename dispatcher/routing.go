@@ -0,0 +1,179 @@
+package dispatcher
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+//route is a compiled routing rule
+type route struct {
+	conf.Route
+	appIDRegex *regexp.Regexp
+}
+
+var (
+	routes      map[string][]route
+	routesMutex sync.Mutex
+
+	// labels of the apps as seen in their last api_post_event
+	appLabels      = make(map[string]map[string]string)
+	appLabelsMutex sync.Mutex
+)
+
+//ConfigureRoutes sets the routing rules per backend name. A backend receives an event if one of its
+//rules matches, backends without rules receive all events.
+func ConfigureRoutes(settings map[string][]conf.Route) error {
+	compiled, err := compileRoutes(settings)
+	if err != nil {
+		return err
+	}
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	routes = compiled
+	return nil
+}
+
+//compileRoutes validates the routing rules and compiles their regular expressions
+func compileRoutes(settings map[string][]conf.Route) (map[string][]route, error) {
+	compiled := make(map[string][]route)
+	for name, rules := range settings {
+		for i, rule := range rules {
+			r := route{Route: rule}
+			if rule.AppIDRegex != "" {
+				var err error
+				if r.appIDRegex, err = regexp.Compile(rule.AppIDRegex); err != nil {
+					return nil, fmt.Errorf("route %d of backend '%s': %s", i, name, err)
+				}
+			}
+			for _, pattern := range []string{rule.AppID, rule.Host} {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("route %d of backend '%s': invalid pattern '%s'", i, name, pattern)
+				}
+			}
+			// viper lower cases all keys
+			compiled[strings.ToLower(name)] = append(compiled[strings.ToLower(name)], r)
+		}
+	}
+	return compiled, nil
+}
+
+//routed reports whether the routing rules send the event to the backend
+func routed(name string, event interface{}) bool {
+	routesMutex.Lock()
+	rules, ok := routes[strings.ToLower(name)]
+	routesMutex.Unlock()
+	if !ok {
+		return true
+	}
+	for _, rule := range rules {
+		if rule.matches(event) {
+			return true
+		}
+	}
+	return false
+}
+
+//matches reports whether all fields of the rule match the event
+func (r route) matches(event interface{}) bool {
+	var eventType string
+	if e, ok := event.(interface {
+		Type() string
+	}); ok {
+		eventType = e.Type()
+	}
+	appID := backend.AppID(event)
+	var taskStatus, host string
+	if e, ok := event.(*backend.StatusUpdateEvent); ok {
+		taskStatus, host = e.Taskstatus, e.Host
+	}
+
+	if len(r.EventTypes) > 0 && !contains(r.EventTypes, eventType) {
+		return false
+	}
+	if r.AppID != "" {
+		if !matchAppID(r.AppID, appID) {
+			return false
+		}
+	}
+	if r.appIDRegex != nil && !r.appIDRegex.MatchString(appID) {
+		return false
+	}
+	if len(r.TaskStatus) > 0 && !contains(r.TaskStatus, taskStatus) {
+		return false
+	}
+	if r.Host != "" {
+		if matched, _ := path.Match(r.Host, host); !matched {
+			return false
+		}
+	}
+	if len(r.Labels) > 0 {
+		labels := labelsOf(event, appID)
+		for key, value := range r.Labels {
+			if labels[key] != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+//matchAppID matches the app id against the glob. A trailing /* matches all apps of the group and its subgroups,
+//p.e. /public/* matches /public/web and /public/team/web.
+func matchAppID(pattern, appID string) bool {
+	if matched, _ := path.Match(pattern, appID); matched || !strings.HasSuffix(pattern, "/*") {
+		return matched
+	}
+	group := strings.TrimSuffix(pattern, "/*")
+	for i := 0; i < len(appID)-1; i++ {
+		if appID[i] != '/' {
+			continue
+		}
+		if matched, _ := path.Match(group, appID[:i]); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+//labelsOf returns the labels of the app the event refers to. Only api_post_events carry the
+//labels, other events use the attached app definition or the labels of the last api_post_event of the app.
+func labelsOf(event interface{}, appID string) map[string]string {
+	if e, ok := event.(*backend.APIRequestEvent); ok {
+		return e.Appdefinition.Labels
+	}
+	if e, ok := event.(interface {
+		Definition() *backend.App
+	}); ok && e.Definition() != nil {
+		return e.Definition().Labels
+	}
+	appLabelsMutex.Lock()
+	defer appLabelsMutex.Unlock()
+	return appLabels[scoped(event, appID)]
+}
+
+//learnLabels remembers the labels of apps from their api_post_events
+func learnLabels(event interface{}) {
+	appLabelsMutex.Lock()
+	defer appLabelsMutex.Unlock()
+	switch e := event.(type) {
+	case *backend.APIRequestEvent:
+		appLabels[scoped(event, e.Appdefinition.ID)] = e.Appdefinition.Labels
+	case *backend.AppTerminatedEvent:
+		delete(appLabels, scoped(event, e.Appid))
+	}
+}
@@ -0,0 +1,95 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+func Test_Routing(t *testing.T) {
+	err := ConfigureRoutes(map[string][]conf.Route{
+		"baboon": {{AppID: "/public/*"}, {AppIDRegex: "^/shop/", TaskStatus: []string{"TASK_RUNNING"}, Host: "*.example.org"}},
+		"vault":  {{EventTypes: []string{"status_update_event"}, Labels: map[string]string{"secrets": "true"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ConfigureRoutes(nil)
+
+	decode := func(payload string) interface{} {
+		_, event, err := Decode([]byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	public := decode(`{"eventType": "status_update_event", "appId": "/public/web", "taskId": "1", "taskStatus": "TASK_KILLED"}`)
+	publicNested := decode(`{"eventType": "status_update_event", "appId": "/public/team/web", "taskId": "1", "taskStatus": "TASK_KILLED"}`)
+	shop := decode(`{"eventType": "status_update_event", "appId": "/shop/cart", "taskId": "1", "taskStatus": "TASK_RUNNING", "host": "node1.example.org"}`)
+	shopElsewhere := decode(`{"eventType": "status_update_event", "appId": "/shop/cart", "taskId": "1", "taskStatus": "TASK_RUNNING", "host": "node1.example.com"}`)
+	internal := decode(`{"eventType": "status_update_event", "appId": "/internal/db", "taskId": "1", "taskStatus": "TASK_RUNNING"}`)
+	created := decode(`{"eventType": "api_post_event", "appDefinition": {"id": "/internal/db", "labels": {"secrets": "true"}}}`)
+
+	expected := []struct {
+		backend string
+		event   interface{}
+		routed  bool
+	}{
+		{"Baboon", public, true},
+		{"Baboon", publicNested, true},
+		{"Baboon", shop, true},
+		{"Baboon", shopElsewhere, false},
+		{"Baboon", internal, false},
+		{"Vault", internal, false},
+		{"Vault", created, false},
+		{"Zmon", internal, true},
+	}
+	for _, e := range expected {
+		if routed(e.backend, e.event) != e.routed {
+			fmt.Printf("Expected routing of %+v to %s to be %t\n", e.event, e.backend, e.routed)
+			t.FailNow()
+		}
+	}
+
+	// status updates are routed by the labels of the app's last api_post_event
+	learnLabels(created)
+	if !routed("Vault", internal) {
+		fmt.Println("Expected status update of labelled app to be routed to Vault")
+		t.FailNow()
+	}
+	learnLabels(&backend.AppTerminatedEvent{Appid: "/internal/db"})
+	if routed("Vault", internal) {
+		fmt.Println("Expected labels to be forgotten after app termination")
+		t.FailNow()
+	}
+
+	if err := ConfigureRoutes(map[string][]conf.Route{"baboon": {{AppIDRegex: "("}}}); err == nil {
+		fmt.Println("Invalid regular expression is accepted")
+		t.FailNow()
+	}
+}
+
+func Test_matchAppID(t *testing.T) {
+	expected := []struct {
+		pattern, appID string
+		matched        bool
+	}{
+		{"/public/*", "/public/web", true},
+		{"/public/*", "/public/team/web", true},
+		{"/public/*", "/public", false},
+		{"/public/*", "/publicity/web", false},
+		{"/*", "/shop/cart", true},
+		{"/team-*/*", "/team-a/shop/cart", true},
+		{"/team-*/*", "/other/team-a/cart", false},
+		{"/public/web-*", "/public/web-1", true},
+		{"/public/web-*", "/public/web-1/worker", false},
+	}
+	for _, e := range expected {
+		if matchAppID(e.pattern, e.appID) != e.matched {
+			fmt.Printf("Expected matching %s against %s to be %t\n", e.appID, e.pattern, e.matched)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+)
+
+//ErrShuttingDown is returned for events dispatched after Drain was called
+var ErrShuttingDown = fmt.Errorf("howler is shutting down and does not accept events anymore")
+
+//draining is set once Drain was called
+var draining int32
+
+//inflightCounter is a WaitGroup which knows how many events it waits for and when they were accepted
+type inflightCounter struct {
+	sync.WaitGroup
+	count    int64
+	mutex    sync.Mutex
+	accepted map[int64]int // number of unfinished events by the time they were accepted, in nanoseconds
+}
+
+func (c *inflightCounter) Add(accepted time.Time, delta int) {
+	c.mutex.Lock()
+	if c.accepted == nil {
+		c.accepted = make(map[int64]int)
+	}
+	key := accepted.UnixNano()
+	if c.accepted[key] += delta; c.accepted[key] <= 0 {
+		delete(c.accepted, key)
+	}
+	c.mutex.Unlock()
+	atomic.AddInt64(&c.count, int64(delta))
+	c.WaitGroup.Add(delta)
+}
+
+func (c *inflightCounter) Done(accepted time.Time) {
+	c.Add(accepted, -1)
+}
+
+//oldest returns when the oldest unfinished event was accepted, false if there is none
+func (c *inflightCounter) oldest() (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var oldest int64
+	for accepted := range c.accepted {
+		if oldest == 0 || accepted < oldest {
+			oldest = accepted
+		}
+	}
+	return time.Unix(0, oldest), oldest != 0
+}
+
+//Drain stops accepting events and waits up to the deadline for the backends to handle the events which
+//are queued or handled already. It returns the number of events which are not finished, the journal
+//keeps them for the next start.
+func Drain(deadline time.Duration) int64 {
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+	// events accepted before the lock is taken are counted as inflight already
+	dispatchMutex.Lock()
+	atomic.StoreInt32(&draining, 1)
+	dispatchMutex.Unlock()
+
+	glog.Infof("draining %d events", atomic.LoadInt64(&inflight.count))
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		unfinished := atomic.LoadInt64(&inflight.count)
+		if unfinished == 0 {
+			return 0
+		}
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			glog.Warningf("%d events were not handled within %s", unfinished, deadline)
+			return unfinished
+		}
+	}
+}
+
+//CloseBackends releases the resources of the backends implementing backend.Closer
+func CloseBackends() {
+	for _, be := range backendconfig.RegisteredBackends {
+		if closer, ok := be.(backend.Closer); ok {
+			if err := closer.Close(); err != nil {
+				glog.Errorf("unable to close backend '%s': %s", be.Name(), err)
+			}
+		}
+	}
+}
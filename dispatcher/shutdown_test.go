@@ -0,0 +1,38 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/backendconfig"
+)
+
+func Test_Drain(t *testing.T) {
+	be := newBlockingBackend("Blocking")
+	backendconfig.RegisteredBackends = []backend.Plugin{be}
+	defer func() {
+		backendconfig.RegisteredBackends = nil
+		atomic.StoreInt32(&draining, 0)
+	}()
+	running := []byte(`{"eventType": "status_update_event", "appId": "/my-app", "taskId": "1", "taskStatus": "TASK_RUNNING"}`)
+	if err := Process(running); err != nil {
+		t.Fatal(err)
+	}
+
+	if unfinished := Drain(10 * time.Millisecond); unfinished != 1 {
+		fmt.Printf("Expected 1 unfinished event, got: %d\n", unfinished)
+		t.FailNow()
+	}
+	if err := Process(running); err != ErrShuttingDown {
+		fmt.Printf("Expected events to be refused while draining, got: %v\n", err)
+		t.FailNow()
+	}
+	close(be.release)
+	if unfinished := Drain(time.Second); unfinished != 0 {
+		fmt.Printf("Expected all events to be handled, got: %d unfinished\n", unfinished)
+		t.FailNow()
+	}
+}
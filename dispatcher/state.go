@@ -0,0 +1,59 @@
+package dispatcher
+
+import (
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+	"github.com/zalando-techmonkeys/howler/state"
+)
+
+//track applies an event to the cluster state, before any backend handles it.
+//The state covers the default cluster only, events of further clusters are not tracked.
+func track(event interface{}) {
+	if backend.ClusterOf(event) != "" {
+		return
+	}
+	switch e := event.(type) {
+	case *backend.APIRequestEvent:
+		state.Cluster.UpdateApp(state.App{
+			ID:        e.Appdefinition.ID,
+			Version:   e.Appdefinition.Version,
+			Instances: e.Appdefinition.Instances,
+			Labels:    e.Appdefinition.Labels,
+		})
+	case *backend.AppTerminatedEvent:
+		state.Cluster.RemoveApp(e.Appid)
+	case *backend.StatusUpdateEvent:
+		state.Cluster.UpdateTask(state.Task{
+			ID:      e.Taskid,
+			AppID:   e.Appid,
+			SlaveID: e.Slaveid,
+			Host:    e.Host,
+			Ports:   e.Ports,
+			Status:  e.Taskstatus,
+			Version: e.Version,
+			Updated: timestamp(e.Timestamp),
+		})
+	case *backend.HealthStatusChangedEvent:
+		state.Cluster.SetHealth(e.Taskid, e.Alive)
+	case *backend.DeploymentInfoEvent:
+		deployment := state.Deployment{ID: e.Plan.ID, Version: e.Plan.Version, Started: timestamp(e.Timestamp)}
+		for _, step := range e.Plan.Steps {
+			deployment.Apps = append(deployment.Apps, step.App)
+		}
+		state.Cluster.StartDeployment(deployment)
+	case *backend.DeploymentSuccessEvent:
+		state.Cluster.FinishDeployment(e.ID)
+	case *backend.DeploymentFailedEvent:
+		state.Cluster.FinishDeployment(e.ID)
+	}
+}
+
+//timestamp parses the timestamp of an event, the zero time if it is missing or invalid
+func timestamp(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
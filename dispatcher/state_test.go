@@ -0,0 +1,31 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zalando-techmonkeys/howler/state"
+)
+
+func Test_track(t *testing.T) {
+	defer state.Cluster.Bootstrap(nil, nil)
+	Process([]byte(`{"eventType": "api_post_event", "appDefinition": {"id": "/tracked", "instances": 1, "version": "v1"}}`))
+	Process([]byte(`{"eventType": "status_update_event", "timestamp": "2014-03-01T23:29:30.158Z", "appId": "/tracked", "taskId": "t1", "taskStatus": "TASK_RUNNING", "host": "node1", "ports": [31000]}`))
+	Process([]byte(`{"eventType": "health_status_changed_event", "appId": "/tracked", "taskId": "t1", "alive": false}`))
+	Wait()
+
+	task, ok := state.Cluster.Task("t1")
+	if !ok || task.Host != "node1" || task.Healthy == nil || *task.Healthy {
+		fmt.Printf("Expected unhealthy task t1 on node1, got: %+v\n", task)
+		t.FailNow()
+	}
+	if app, ok := state.Cluster.App("/tracked"); !ok || app.Version != "v1" {
+		fmt.Printf("Expected app /tracked in version v1, got: %+v\n", app)
+		t.FailNow()
+	}
+	Process([]byte(`{"eventType": "app_terminated_event", "appId": "/tracked"}`))
+	if tasks := state.Cluster.Tasks("/tracked"); len(tasks) != 0 {
+		fmt.Printf("Expected no tasks after termination, got: %+v\n", tasks)
+		t.FailNow()
+	}
+}
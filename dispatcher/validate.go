@@ -0,0 +1,158 @@
+package dispatcher
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+)
+
+//TaskStatuses are the task states Marathon reports in status update events
+var TaskStatuses = map[string]bool{
+	"TASK_STAGING":          true,
+	"TASK_STARTING":         true,
+	"TASK_RUNNING":          true,
+	"TASK_KILLING":          true,
+	"TASK_FINISHED":         true,
+	"TASK_FAILED":           true,
+	"TASK_KILLED":           true,
+	"TASK_LOST":             true,
+	"TASK_ERROR":            true,
+	"TASK_DROPPED":          true,
+	"TASK_UNREACHABLE":      true,
+	"TASK_GONE":             true,
+	"TASK_GONE_BY_OPERATOR": true,
+	"TASK_UNKNOWN":          true,
+}
+
+//Violation describes a field of an event which does not match the schema of its event type
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+//ValidationError is returned for events violating the schema of their event type
+type ValidationError struct {
+	EventType  string      `json:"eventType"`
+	Violations []Violation `json:"violations"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = fmt.Sprintf("%s %s", violation.Field, violation.Message)
+	}
+	return fmt.Sprintf("invalid event of type '%s': %s", e.EventType, strings.Join(messages, ", "))
+}
+
+//validation collects the violations of an event
+type validation []Violation
+
+func (v *validation) required(field, value string) {
+	if value == "" {
+		*v = append(*v, Violation{Field: field, Message: "is required"})
+	}
+}
+
+func (v *validation) appID(field, value string) {
+	v.required(field, value)
+	if value != "" && !strings.HasPrefix(value, "/") {
+		*v = append(*v, Violation{Field: field, Message: "must be an absolute app id"})
+	}
+}
+
+//validate checks the fields backends rely on for the type of the event
+func validate(eventType string, event interface{}) error {
+	var v validation
+	switch e := event.(type) {
+	case *backend.APIRequestEvent:
+		v.appID("appDefinition.id", e.Appdefinition.ID)
+	case *backend.StatusUpdateEvent:
+		v.appID("appId", e.Appid)
+		v.required("taskId", e.Taskid)
+		v.required("taskStatus", e.Taskstatus)
+		if e.Taskstatus != "" && !TaskStatuses[e.Taskstatus] {
+			v = append(v, Violation{Field: "taskStatus", Message: fmt.Sprintf("has unknown value '%s'", e.Taskstatus)})
+		}
+	case *backend.AppTerminatedEvent:
+		v.appID("appId", e.Appid)
+	case *backend.AddHealthCheckEvent:
+		v.appID("appId", e.Appid)
+	case *backend.RemoveHealthCheckEvent:
+		v.appID("appId", e.Appid)
+	case *backend.FailedHealthCheckEvent:
+		v.appID("appId", e.Appid)
+		v.required("taskId", e.Taskid)
+	case *backend.HealthStatusChangedEvent:
+		v.appID("appId", e.Appid)
+		v.required("taskId", e.Taskid)
+	case *backend.GroupChangeSuccessEvent:
+		v.required("groupId", e.Groupid)
+	case *backend.GroupChangeFailedEvent:
+		v.required("groupId", e.Groupid)
+	case *backend.DeploymentSuccessEvent:
+		v.required("id", e.ID)
+	case *backend.DeploymentFailedEvent:
+		v.required("id", e.ID)
+	case *backend.DeploymentInfoEvent:
+		v.required("plan.id", e.Plan.ID)
+	case *backend.DeploymentStepSuccessEvent:
+		v.required("plan.id", e.Plan.ID)
+	case *backend.DeploymentStepFailureEvent:
+		v.required("plan.id", e.Plan.ID)
+	case *backend.SubscribeEvent:
+		v.required("callbackUrl", e.Callbackurl)
+	case *backend.UnsubscribeEvent:
+		v.required("callbackUrl", e.Callbackurl)
+	}
+	if len(v) > 0 {
+		return &ValidationError{EventType: eventType, Violations: v}
+	}
+	return nil
+}
+
+var (
+	rejected      = make(map[string]int64)
+	rejectedMutex sync.Mutex
+)
+
+//reject counts a payload which could not be decoded or validated. Payloads without a known
+//event type are counted as "unknown".
+func reject(eventType string) {
+	if _, ok := backend.EventTypes[eventType]; !ok {
+		eventType = "unknown"
+	}
+	rejectedMutex.Lock()
+	defer rejectedMutex.Unlock()
+	rejected[eventType]++
+}
+
+//Rejected returns the number of rejected payloads per event type
+func Rejected() map[string]int64 {
+	rejectedMutex.Lock()
+	defer rejectedMutex.Unlock()
+	counts := make(map[string]int64)
+	for eventType, count := range rejected {
+		counts[eventType] = count
+	}
+	return counts
+}
+
+//RejectedAspect exposes the number of rejected payloads on the monitoring endpoint
+type RejectedAspect struct{}
+
+//GetStats returns the number of rejected payloads per event type
+func (a *RejectedAspect) GetStats() interface{} {
+	return Rejected()
+}
+
+//Name returns the name of the aspect
+func (a *RejectedAspect) Name() string {
+	return "Rejected"
+}
+
+//InRoot returns false, the stats are served at /Rejected
+func (a *RejectedAspect) InRoot() bool {
+	return false
+}
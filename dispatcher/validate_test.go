@@ -0,0 +1,42 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_Validate(t *testing.T) {
+	before := Rejected()
+	_, _, err := Decode([]byte(`{"eventType": "status_update_event", "appId": "my-app", "taskStatus": "TASK_EXPLODED"}`))
+	invalid, ok := err.(*ValidationError)
+	if !ok {
+		fmt.Printf("Expected ValidationError, got: %v\n", err)
+		t.FailNow()
+	}
+	expected := []Violation{
+		{Field: "appId", Message: "must be an absolute app id"},
+		{Field: "taskId", Message: "is required"},
+		{Field: "taskStatus", Message: "has unknown value 'TASK_EXPLODED'"},
+	}
+	if len(invalid.Violations) != len(expected) {
+		fmt.Printf("Expected %d violations, got: %+v\n", len(expected), invalid.Violations)
+		t.FailNow()
+	}
+	for i, violation := range expected {
+		if invalid.Violations[i] != violation {
+			fmt.Printf("Expected: %+v, got: %+v\n", violation, invalid.Violations[i])
+			t.FailNow()
+		}
+	}
+
+	Decode([]byte(`{"eventType": "app_terminated_event"}`))
+	Decode([]byte(`{"eventType": "no_such_event"}`))
+	Decode([]byte(`not json`))
+	after := Rejected()
+	if after["status_update_event"]-before["status_update_event"] != 1 ||
+		after["app_terminated_event"]-before["app_terminated_event"] != 1 ||
+		after["unknown"]-before["unknown"] != 2 {
+		fmt.Printf("Unexpected rejected counts, before: %v, after: %v\n", before, after)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,280 @@
+//Package journal implements a write-ahead log of accepted events, so events which were not
+//handled by all backends before a crash or restart can be re-dispatched on startup.
+
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+//DefaultSegmentSize is the size in bytes after which a new segment file is started
+const DefaultSegmentSize = 64 * 1024 * 1024
+
+const segmentSuffix = ".journal"
+
+//record is a single line in a segment file. An event record is followed by
+//one done record per backend once the backend has handled the event.
+type record struct {
+	ID       uint64          `json:"id"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Backends []string        `json:"backends,omitempty"`
+	Done     string          `json:"done,omitempty"`
+}
+
+//Entry is an event that has not been handled by all of its backends yet
+type Entry struct {
+	ID       uint64
+	Payload  []byte
+	Backends []string // backends which did not handle the event yet
+}
+
+//pending tracks the unfinished backends of an event
+type pending struct {
+	segment  int
+	payload  []byte
+	backends map[string]bool
+}
+
+//Journal is an fsync'd, segment-rotated write-ahead log
+type Journal struct {
+	mutex       sync.Mutex
+	dir         string
+	segmentSize int64
+	file        *os.File
+	oldest      int
+	current     int
+	written     int64
+	nextID      uint64
+	pending     map[uint64]*pending
+	open        map[int]int // number of pending events per segment
+}
+
+//Open reads all segments in dir and returns the journal together with the unfinished entries
+func Open(dir string, segmentSize int64) (*Journal, []Entry, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+	j := &Journal{
+		dir:         dir,
+		segmentSize: segmentSize,
+		nextID:      1,
+		pending:     make(map[uint64]*pending),
+		open:        make(map[int]int),
+	}
+	segments, err := j.segments()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, segment := range segments {
+		if err := j.load(segment); err != nil {
+			return nil, nil, err
+		}
+		if i == 0 {
+			j.oldest = segment
+		}
+		j.current = segment
+	}
+	// never append to an existing segment, its last record might be torn
+	if err := j.rotate(); err != nil {
+		return nil, nil, err
+	}
+	j.compact()
+
+	var entries []Entry
+	for id, p := range j.pending {
+		entry := Entry{ID: id, Payload: p.payload}
+		for backend := range p.backends {
+			entry.Backends = append(entry.Backends, backend)
+		}
+		sort.Strings(entry.Backends)
+		entries = append(entries, entry)
+	}
+	sort.Sort(byID(entries))
+	return j, entries, nil
+}
+
+type byID []Entry
+
+func (e byID) Len() int           { return len(e) }
+func (e byID) Swap(a, b int)      { e[a], e[b] = e[b], e[a] }
+func (e byID) Less(a, b int) bool { return e[a].ID < e[b].ID }
+
+//segments returns the numbers of all segment files in ascending order
+func (j *Journal) segments() ([]int, error) {
+	files, err := filepath.Glob(filepath.Join(j.dir, "*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var segments []int
+	for _, file := range files {
+		var segment int
+		if _, err := fmt.Sscanf(strings.TrimSuffix(filepath.Base(file), segmentSuffix), "%d", &segment); err != nil {
+			glog.Warningf("ignoring unknown file %s in journal", file)
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (j *Journal) segmentPath(segment int) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%08d%s", segment, segmentSuffix))
+}
+
+//load replays a segment file into the pending events
+func (j *Journal) load(segment int) error {
+	f, err := os.Open(j.segmentPath(segment))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// a torn write at the end of a segment, the event was never acknowledged
+			glog.Warningf("skipping corrupt record in journal segment %d: %s", segment, err)
+			continue
+		}
+		if r.ID >= j.nextID {
+			j.nextID = r.ID + 1
+		}
+		if r.Done != "" {
+			j.done(r.ID, r.Done)
+			continue
+		}
+		p := &pending{segment: segment, payload: r.Payload, backends: make(map[string]bool)}
+		for _, backend := range r.Backends {
+			p.backends[backend] = true
+		}
+		if len(p.backends) > 0 {
+			j.pending[r.ID] = p
+			j.open[segment]++
+		}
+	}
+	return scanner.Err()
+}
+
+//rotate closes the current segment and starts a new one
+func (j *Journal) rotate() error {
+	if j.file != nil {
+		if err := j.file.Close(); err != nil {
+			return err
+		}
+	}
+	j.current++
+	f, err := os.OpenFile(j.segmentPath(j.current), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	j.file = f
+	j.written = 0
+	return nil
+}
+
+//write appends a record to the current segment and syncs it to disk
+func (j *Journal) write(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if j.written > 0 && j.written+int64(len(line)) > j.segmentSize {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := j.file.Write(line)
+	j.written += int64(n)
+	if err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+//Append writes an accepted event and the backends it is dispatched to. It returns the id of the event.
+func (j *Journal) Append(payload []byte, backends []string) (uint64, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	id := j.nextID
+	if err := j.write(record{ID: id, Payload: payload, Backends: backends}); err != nil {
+		return 0, fmt.Errorf("unable to write event to journal: %s", err)
+	}
+	j.nextID++
+	if len(backends) == 0 {
+		return id, nil
+	}
+	p := &pending{segment: j.current, payload: payload, backends: make(map[string]bool)}
+	for _, backend := range backends {
+		p.backends[backend] = true
+	}
+	j.pending[id] = p
+	j.open[j.current]++
+	return id, nil
+}
+
+//Complete marks the event as handled by the backend
+func (j *Journal) Complete(id uint64, backend string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if err := j.write(record{ID: id, Done: backend}); err != nil {
+		return fmt.Errorf("unable to mark event %d as done in journal: %s", id, err)
+	}
+	j.done(id, backend)
+	j.compact()
+	return nil
+}
+
+//done removes the backend from the pending event
+func (j *Journal) done(id uint64, backend string) {
+	p, ok := j.pending[id]
+	if !ok {
+		return
+	}
+	delete(p.backends, backend)
+	if len(p.backends) == 0 {
+		delete(j.pending, id)
+		j.open[p.segment]--
+	}
+}
+
+//compact removes finished segments. Only the oldest segments are removed, as
+//done records of events in a segment are always stored in the same or a later one.
+func (j *Journal) compact() {
+	for j.oldest < j.current && j.open[j.oldest] == 0 {
+		if err := os.Remove(j.segmentPath(j.oldest)); err != nil && !os.IsNotExist(err) {
+			glog.Errorf("unable to remove journal segment %d: %s", j.oldest, err)
+			return
+		}
+		delete(j.open, j.oldest)
+		j.oldest++
+	}
+}
+
+//Pending returns the number of events not handled by all backends yet
+func (j *Journal) Pending() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return len(j.pending)
+}
+
+//Close closes the current segment
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.file.Close()
+}
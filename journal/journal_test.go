@@ -0,0 +1,93 @@
+package journal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Recovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "howler-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, entries, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		fmt.Printf("Expected an empty journal, got: %+v\n", entries)
+		t.FailNow()
+	}
+	first, _ := j.Append([]byte(`{"eventType": "status_update_event"}`), []string{"Baboon", "Zmon"})
+	second, _ := j.Append([]byte(`{"eventType": "app_terminated_event"}`), []string{"Baboon"})
+	j.Complete(first, "Zmon")
+	j.Complete(second, "Baboon")
+	j.Close()
+
+	j, entries, err = Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if len(entries) != 1 || entries[0].ID != first {
+		fmt.Printf("Expected only event %d to be unfinished, got: %+v\n", first, entries)
+		t.FailNow()
+	}
+	if len(entries[0].Backends) != 1 || entries[0].Backends[0] != "Baboon" {
+		fmt.Printf("Expected Baboon to be unfinished, got: %v\n", entries[0].Backends)
+		t.FailNow()
+	}
+	if string(entries[0].Payload) != `{"eventType":"status_update_event"}` {
+		fmt.Printf("Unexpected payload: %s\n", entries[0].Payload)
+		t.FailNow()
+	}
+	third, _ := j.Append([]byte(`{}`), []string{"Baboon"})
+	if third <= second {
+		fmt.Printf("Expected ids to grow after recovery, got: %d\n", third)
+		t.FailNow()
+	}
+}
+
+func Test_Rotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "howler-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, _, err := Open(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	var ids []uint64
+	for i := 0; i < 10; i++ {
+		id, err := j.Append([]byte(`{"eventType": "status_update_event"}`), []string{"Baboon"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(segments) < 2 {
+		fmt.Printf("Expected rotated segments, got: %v\n", segments)
+		t.FailNow()
+	}
+	for _, id := range ids {
+		j.Complete(id, "Baboon")
+	}
+	segments, _ = filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(segments) != 1 {
+		fmt.Printf("Expected finished segments to be removed, got: %v\n", segments)
+		t.FailNow()
+	}
+	if j.Pending() != 0 {
+		fmt.Printf("Expected no pending events, got: %d\n", j.Pending())
+		t.FailNow()
+	}
+}
@@ -0,0 +1,178 @@
+package leader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ConsulLock elects the leader among instances on several hosts with a key in Consul's KV store.
+//The key is acquired with a session, which is invalidated by Consul if it is not renewed within the ttl.
+type ConsulLock struct {
+	url     string
+	key     string
+	http    *http.Client
+	mutex   sync.Mutex
+	session string
+	held    bool
+}
+
+//MinConsulTTL is the shortest session ttl Consul accepts
+const MinConsulTTL = 10 * time.Second
+
+//NewConsulLock creates a lock on the key of the Consul agent at url, p.e. http://localhost:8500
+func NewConsulLock(url string, key string) *ConsulLock {
+	return &ConsulLock{
+		url:  strings.TrimRight(url, "/"),
+		key:  strings.Trim(key, "/"),
+		http: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+//Acquire renews the session, creating a new one if it expired, and tries to acquire the key with it
+func (l *ConsulLock) Acquire(holder string, ttl time.Duration) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.held = false
+	if l.session != "" {
+		renewed, err := l.renew()
+		if err != nil {
+			return false, err
+		}
+		if !renewed {
+			l.session = ""
+		}
+	}
+	if l.session == "" {
+		session, err := l.createSession(holder, ttl)
+		if err != nil {
+			return false, err
+		}
+		l.session = session
+	}
+	var acquired bool
+	if err := l.put(fmt.Sprintf("/v1/kv/%s?acquire=%s", l.key, l.session), []byte(holder), &acquired); err != nil {
+		return false, err
+	}
+	l.held = acquired
+	return acquired, nil
+}
+
+//Release releases the key and destroys the session
+func (l *ConsulLock) Release(holder string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.session == "" {
+		return nil
+	}
+	var released bool
+	err := l.put(fmt.Sprintf("/v1/kv/%s?release=%s", l.key, l.session), nil, &released)
+	if err == nil {
+		err = l.put("/v1/session/destroy/"+l.session, nil, nil)
+	}
+	l.session, l.held = "", false
+	return err
+}
+
+//PublishWatermark stores the watermark in the key's watermark key, if the holder holds the key
+func (l *ConsulLock) PublishWatermark(holder string, mark time.Time) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.held {
+		return nil
+	}
+	return l.put(fmt.Sprintf("/v1/kv/%s/watermark", l.key), []byte(mark.UTC().Format(time.RFC3339Nano)), nil)
+}
+
+//Watermark reads the watermark the leader stored last
+func (l *ConsulLock) Watermark() (time.Time, error) {
+	res, err := l.http.Get(fmt.Sprintf("%s/v1/kv/%s/watermark?raw", l.url, l.key))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return time.Time{}, nil
+	}
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("GET %s returned %s: %s", res.Request.URL.Path, res.Status, strings.TrimSpace(string(content)))
+	}
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(string(content)))
+}
+
+//createSession creates a session which releases the key when it is invalidated
+func (l *ConsulLock) createSession(holder string, ttl time.Duration) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"Name":     holder,
+		"TTL":      sessionTTL(ttl),
+		"Behavior": "release",
+	})
+	if err != nil {
+		return "", err
+	}
+	var session struct {
+		ID string
+	}
+	if err := l.put("/v1/session/create", body, &session); err != nil {
+		return "", err
+	}
+	return session.ID, nil
+}
+
+//sessionTTL returns the ttl of a session in whole seconds, at least MinConsulTTL
+func sessionTTL(ttl time.Duration) string {
+	if ttl < MinConsulTTL {
+		ttl = MinConsulTTL
+	}
+	return fmt.Sprintf("%ds", int((ttl+time.Second-1)/time.Second))
+}
+
+//renew renews the session and reports whether it still exists
+func (l *ConsulLock) renew() (bool, error) {
+	req, err := http.NewRequest("PUT", l.url+"/v1/session/renew/"+l.session, nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := l.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("PUT %s returned %s", req.URL.Path, res.Status)
+}
+
+//put sends a PUT request to the Consul API and decodes the response into result, if it is not nil
+func (l *ConsulLock) put(path string, body []byte, result interface{}) error {
+	req, err := http.NewRequest("PUT", l.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res, err := l.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("PUT %s returned %s: %s", req.URL.Path, res.Status, strings.TrimSpace(string(message)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
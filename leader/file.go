@@ -0,0 +1,88 @@
+package leader
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//FileLock elects the leader among the instances on a single host with an flock(2) on a file.
+//The kernel releases the lock if the leader dies, so the ttl is not needed.
+type FileLock struct {
+	path  string
+	mutex sync.Mutex
+	file  *os.File
+}
+
+//NewFileLock creates a lock on the file at path, which is created if it does not exist
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+//Acquire takes the lock, if no other process holds it
+func (l *FileLock) Acquire(holder string, ttl time.Duration) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file != nil {
+		return true, nil
+	}
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return false, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return false, nil
+		}
+		return false, err
+	}
+	// the holder is informational only, p.e. to find the leader on the host
+	file.Truncate(0)
+	file.WriteAt([]byte(holder+"\n"), 0)
+	l.file = file
+	return true, nil
+}
+
+//Release gives up the lock
+func (l *FileLock) Release(holder string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+	l.file = nil
+	return err
+}
+
+//PublishWatermark writes the watermark next to the lock file, if the holder holds the lock
+func (l *FileLock) PublishWatermark(holder string, mark time.Time) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	path := l.path + ".watermark"
+	// write to a temporary file first, so followers never read a torn watermark
+	if err := ioutil.WriteFile(path+".tmp", []byte(mark.UTC().Format(time.RFC3339Nano)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+//Watermark reads the watermark the leader wrote last
+func (l *FileLock) Watermark() (time.Time, error) {
+	content, err := ioutil.ReadFile(l.path + ".watermark")
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(string(content)))
+}
@@ -0,0 +1,156 @@
+//Package leader elects one of several Howler instances to dispatch events to the backends,
+//so resources are not modified twice for the same event.
+
+package leader
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+//Lock is a lock provider. The lock expires if it is not renewed within the ttl,
+//so a crashed leader is replaced.
+type Lock interface {
+	// Acquire takes the lock for the holder or renews it, and reports whether the holder holds it
+	Acquire(holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lock if the holder holds it
+	Release(holder string) error
+}
+
+//Watermarks is implemented by locks which can share the progress of the leader with the followers.
+//The watermark is the time before which the leader handled all events it accepted, so followers know
+//which of the events they keep for a takeover can be forgotten.
+type Watermarks interface {
+	// PublishWatermark stores the watermark, if the holder holds the lock
+	PublishWatermark(holder string, mark time.Time) error
+	// Watermark returns the watermark published last, the zero time if none was published yet
+	Watermark() (time.Time, error)
+}
+
+//Elector campaigns for the lock and keeps it renewed while it is leading
+type Elector struct {
+	lock      Lock
+	id        string
+	ttl       time.Duration
+	leading   int32
+	renewed   time.Time
+	onChange  func(leading bool)
+	watermark func() time.Time
+	followed  func(mark time.Time)
+}
+
+//NewElector creates an Elector campaigning for the lock as id. onChange is called whenever
+//the instance becomes leader or loses the leadership.
+func NewElector(lock Lock, id string, ttl time.Duration, onChange func(leading bool)) *Elector {
+	return &Elector{lock: lock, id: id, ttl: ttl, onChange: onChange}
+}
+
+//ShareProgress makes the leader publish its watermark and the followers read the leader's one whenever
+//the lock is renewed, if the lock implements Watermarks. It must be called before Run.
+func (e *Elector) ShareProgress(watermark func() time.Time, followed func(mark time.Time)) {
+	e.watermark = watermark
+	e.followed = followed
+}
+
+//ID returns the id the elector campaigns as
+func (e *Elector) ID() string {
+	return e.id
+}
+
+//IsLeader reports whether this instance holds the lock
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leading) == 1
+}
+
+//Run campaigns until stop is closed and releases the lock afterwards. The lock is renewed three
+//times per ttl. A leader which is refused the lock steps down at once, one which fails to reach the
+//lock provider keeps leading until the lock might have expired, that is a third of the ttl before it.
+func (e *Elector) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		e.campaign()
+		var expired <-chan time.Time
+		if e.IsLeader() {
+			expired = time.After(e.expiry().Sub(time.Now()))
+		}
+		select {
+		case <-ticker.C:
+		case <-expired:
+			glog.Errorf("unable to renew leader lock since %s", e.renewed)
+			e.set(false)
+		case <-stop:
+			if e.IsLeader() {
+				if err := e.lock.Release(e.id); err != nil {
+					glog.Errorf("unable to release leader lock: %s", err)
+				}
+				e.set(false)
+			}
+			return
+		}
+	}
+}
+
+func (e *Elector) campaign() {
+	attempt := time.Now()
+	leading, err := e.lock.Acquire(e.id, e.ttl)
+	if err != nil {
+		glog.Errorf("unable to acquire leader lock: %s", err)
+		// the lock outlives an unreachable lock provider, no other instance can take over before it expires
+		leading = e.IsLeader() && time.Now().Before(e.expiry())
+	} else if leading {
+		e.renewed = attempt
+	}
+	e.set(leading)
+	e.shareProgress(leading)
+}
+
+//expiry returns the time a leader which can not renew the lock steps down, leaving a third of the
+//ttl for clocks and requests to the lock provider before the lock expires
+func (e *Elector) expiry() time.Time {
+	return e.renewed.Add(e.ttl - e.ttl/3)
+}
+
+func (e *Elector) shareProgress(leading bool) {
+	marks, ok := e.lock.(Watermarks)
+	if !ok || e.watermark == nil {
+		return
+	}
+	if leading {
+		if err := marks.PublishWatermark(e.id, e.watermark()); err != nil {
+			glog.Errorf("unable to publish watermark: %s", err)
+		}
+		return
+	}
+	if e.followed == nil {
+		return
+	}
+	mark, err := marks.Watermark()
+	if err != nil {
+		glog.Errorf("unable to read the watermark of the leader: %s", err)
+		return
+	}
+	if !mark.IsZero() {
+		e.followed(mark)
+	}
+}
+
+func (e *Elector) set(leading bool) {
+	var value int32
+	if leading {
+		value = 1
+	}
+	if atomic.SwapInt32(&e.leading, value) == value {
+		return
+	}
+	if leading {
+		glog.Infof("%s is leader now", e.id)
+	} else {
+		glog.Warningf("%s is not leader anymore", e.id)
+	}
+	if e.onChange != nil {
+		e.onChange(leading)
+	}
+}
@@ -0,0 +1,303 @@
+package leader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_FileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "howler-leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "howler.lock")
+	first, second := NewFileLock(path), NewFileLock(path)
+
+	if acquired, err := first.Acquire("first", time.Second); err != nil || !acquired {
+		fmt.Printf("Expected the first instance to acquire the free lock, got: %v, %v\n", acquired, err)
+		t.FailNow()
+	}
+	if acquired, err := first.Acquire("first", time.Second); err != nil || !acquired {
+		fmt.Printf("Expected the first instance to keep the lock, got: %v, %v\n", acquired, err)
+		t.FailNow()
+	}
+	if acquired, err := second.Acquire("second", time.Second); err != nil || acquired {
+		fmt.Printf("Expected the second instance not to acquire the held lock, got: %v, %v\n", acquired, err)
+		t.FailNow()
+	}
+	if err := first.Release("first"); err != nil {
+		t.Fatal(err)
+	}
+	if acquired, err := second.Acquire("second", time.Second); err != nil || !acquired {
+		fmt.Printf("Expected the second instance to take over the released lock, got: %v, %v\n", acquired, err)
+		t.FailNow()
+	}
+	second.Release("second")
+}
+
+//consulStandIn implements the session and KV endpoints of the Consul API used by ConsulLock
+type consulStandIn struct {
+	mutex     sync.Mutex
+	sessions  map[string]bool
+	holder    string // session holding the key
+	next      int
+	watermark string
+}
+
+func (c *consulStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch {
+	case r.URL.Path == "/v1/session/create":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["Behavior"] != "release" || body["TTL"] == "" {
+			http.Error(w, "unexpected session", http.StatusBadRequest)
+			return
+		}
+		// like Consul, ttls below 10s are refused
+		if ttl, err := time.ParseDuration(body["TTL"]); err != nil || ttl < 10*time.Second {
+			http.Error(w, "Invalid Session TTL", http.StatusInternalServerError)
+			return
+		}
+		c.next++
+		id := fmt.Sprintf("session-%d", c.next)
+		c.sessions[id] = true
+		fmt.Fprintf(w, `{"ID": "%s"}`, id)
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+		if !c.sessions[strings.TrimPrefix(r.URL.Path, "/v1/session/renew/")] {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+		delete(c.sessions, strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/"))
+		fmt.Fprint(w, `true`)
+	case r.URL.Path == "/v1/kv/service/howler/leader/watermark":
+		if r.Method == "PUT" {
+			body, _ := ioutil.ReadAll(r.Body)
+			c.watermark = string(body)
+			fmt.Fprint(w, `true`)
+			return
+		}
+		if c.watermark == "" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, c.watermark)
+	case r.URL.Path == "/v1/kv/service/howler/leader":
+		if session := r.URL.Query().Get("acquire"); session != "" {
+			if c.holder == "" {
+				c.holder = session
+			}
+			fmt.Fprint(w, c.holder == session)
+			return
+		}
+		if session := r.URL.Query().Get("release"); session != "" && c.holder == session {
+			c.holder = ""
+		}
+		fmt.Fprint(w, `true`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+//expire invalidates a session like Consul does when its ttl passed
+func (c *consulStandIn) expire(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.sessions, id)
+	if c.holder == id {
+		c.holder = ""
+	}
+}
+
+func Test_ConsulLock(t *testing.T) {
+	consul := &consulStandIn{sessions: make(map[string]bool)}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+	first, second := NewConsulLock(server.URL, "/service/howler/leader"), NewConsulLock(server.URL, "service/howler/leader")
+
+	if acquired, err := first.Acquire("first", 15*time.Second); err != nil || !acquired {
+		fmt.Printf("Expected the first instance to acquire the free key, got: %v, %v\n", acquired, err)
+		t.FailNow()
+	}
+	if acquired, err := second.Acquire("second", 15*time.Second); err != nil || acquired {
+		fmt.Printf("Expected the second instance not to acquire the held key, got: %v, %v\n", acquired, err)
+		t.FailNow()
+	}
+	if acquired, err := first.Acquire("first", 15*time.Second); err != nil || !acquired {
+		fmt.Printf("Expected the first instance to renew its session and keep the key, got: %v, %v\n", acquired, err)
+		t.FailNow()
+	}
+
+	// the first instance lost its session, p.e. during a network partition
+	consul.expire("session-1")
+	if acquired, err := second.Acquire("second", 15*time.Second); err != nil || !acquired {
+		fmt.Printf("Expected the second instance to take over the key, got: %v, %v\n", acquired, err)
+		t.FailNow()
+	}
+	if acquired, err := first.Acquire("first", 15*time.Second); err != nil || acquired {
+		fmt.Printf("Expected the first instance to follow with a new session, got: %v, %v\n", acquired, err)
+		t.FailNow()
+	}
+	mark := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := first.PublishWatermark("first", mark); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.PublishWatermark("second", mark); err != nil {
+		t.Fatal(err)
+	}
+	if published, err := first.Watermark(); err != nil || !published.Equal(mark) {
+		fmt.Printf("Expected the follower to read the watermark of the leader only, got: %v, %v\n", published, err)
+		t.FailNow()
+	}
+	if err := second.Release("second"); err != nil {
+		t.Fatal(err)
+	}
+	if acquired, err := first.Acquire("first", 15*time.Second); err != nil || !acquired {
+		fmt.Printf("Expected the first instance to acquire the released key, got: %v, %v\n", acquired, err)
+		t.FailNow()
+	}
+}
+
+func Test_ConsulLockShortTTL(t *testing.T) {
+	consul := &consulStandIn{sessions: make(map[string]bool)}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+	lock := NewConsulLock(server.URL, "service/howler/leader")
+
+	for _, ttl := range []time.Duration{500 * time.Millisecond, 3 * time.Second} {
+		if acquired, err := lock.Acquire("first", ttl); err != nil || !acquired {
+			fmt.Printf("Expected a ttl of %s to be raised to Consul's minimum, got: %v, %v\n", ttl, acquired, err)
+			t.FailNow()
+		}
+		lock.Release("first")
+	}
+	if ttl := sessionTTL(15500 * time.Millisecond); ttl != "16s" {
+		fmt.Printf("Expected the ttl to be rounded up to whole seconds, got: %s\n", ttl)
+		t.FailNow()
+	}
+}
+
+//flakyLock is a lock which is lost while failing is set
+type flakyLock struct {
+	mutex   sync.Mutex
+	failing bool
+}
+
+func (l *flakyLock) Acquire(holder string, ttl time.Duration) (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.failing {
+		return false, fmt.Errorf("lock provider unavailable")
+	}
+	return true, nil
+}
+
+func (l *flakyLock) Release(holder string) error { return nil }
+
+func (l *flakyLock) fail(failing bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.failing = failing
+}
+
+func Test_Elector(t *testing.T) {
+	lock := &flakyLock{}
+	changes := make(chan bool, 10)
+	elector := NewElector(lock, "howler-1", 30*time.Millisecond, func(leading bool) { changes <- leading })
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		elector.Run(stop)
+		close(done)
+	}()
+
+	expect := func(leading bool) {
+		select {
+		case change := <-changes:
+			if change != leading {
+				fmt.Printf("Expected leading to change to %v, got: %v\n", leading, change)
+				t.FailNow()
+			}
+		case <-time.After(time.Second):
+			fmt.Printf("Expected leading to change to %v\n", leading)
+			t.FailNow()
+		}
+	}
+	expect(true)
+	if !elector.IsLeader() {
+		fmt.Println("Expected the elector to lead")
+		t.FailNow()
+	}
+	// an instance which can not renew the lock must assume another one took over once it might have expired
+	lock.fail(true)
+	expect(false)
+	lock.fail(false)
+	expect(true)
+	close(stop)
+	<-done
+	expect(false)
+}
+
+func Test_ElectorRenewalFailure(t *testing.T) {
+	lock := &flakyLock{}
+	elector := NewElector(lock, "howler-1", time.Minute, nil)
+	elector.campaign()
+	lock.fail(true)
+	elector.campaign()
+	if !elector.IsLeader() {
+		fmt.Println("Expected a single failed renewal not to end the leadership")
+		t.FailNow()
+	}
+	elector.renewed = time.Now().Add(-40 * time.Second)
+	elector.campaign()
+	if elector.IsLeader() {
+		fmt.Println("Expected the leadership to end a third of the ttl before the lock expires")
+		t.FailNow()
+	}
+	lock.fail(false)
+	elector.campaign()
+	if !elector.IsLeader() {
+		fmt.Println("Expected the elector to lead again")
+		t.FailNow()
+	}
+}
+
+func Test_ShareProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "howler-leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "howler.lock")
+	mark := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	leading := NewElector(NewFileLock(path), "leader", time.Second, nil)
+	leading.ShareProgress(func() time.Time { return mark }, nil)
+	var followed time.Time
+	following := NewElector(NewFileLock(path), "follower", time.Second, nil)
+	following.ShareProgress(func() time.Time { return time.Now() }, func(mark time.Time) { followed = mark })
+
+	if published, err := NewFileLock(path).Watermark(); err != nil || !published.IsZero() {
+		fmt.Printf("Expected no watermark before a leader published one, got: %v, %v\n", published, err)
+		t.FailNow()
+	}
+	leading.campaign()
+	following.campaign()
+	if !leading.IsLeader() || following.IsLeader() || !followed.Equal(mark) {
+		fmt.Printf("Expected the follower to get the watermark of the leader, got: %v\n", followed)
+		t.FailNow()
+	}
+	leading.lock.Release("leader")
+}
@@ -5,12 +5,21 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/zalando-techmonkeys/howler/api"
 	"github.com/zalando-techmonkeys/howler/conf"
+	"github.com/zalando-techmonkeys/howler/deadletter"
+	"github.com/zalando-techmonkeys/howler/dispatcher"
+	"github.com/zalando-techmonkeys/howler/journal"
+	"github.com/zalando-techmonkeys/howler/leader"
+	"github.com/zalando-techmonkeys/howler/marathon"
+	"github.com/zalando-techmonkeys/howler/state"
 )
 
 //Version set version information at build time
@@ -33,7 +42,8 @@ Usage of %s
 ================
 Example:
   %% %s
-`, bin, bin)
+  %% %s replay --file events.jsonl [--backend Baboon] [--rate N]
+`, bin, bin, bin)
 		flag.PrintDefaults()
 	}
 	serverConfig = conf.New()
@@ -49,6 +59,10 @@ Example:
 	flag.StringVar(&serverConfig.TokenURL, "oauth-tokeninfourl", serverConfig.TokenURL, "OAuth2 Auth URL")
 	flag.StringVar(&serverConfig.TLSCertfilePath, "tls-cert", serverConfig.TLSCertfilePath, "TLS Certfile")
 	flag.StringVar(&serverConfig.TLSKeyfilePath, "tls-key", serverConfig.TLSKeyfilePath, "TLS Keyfile")
+	if serverConfig.EventSource == "" {
+		serverConfig.EventSource = "callback"
+	}
+	flag.StringVar(&serverConfig.EventSource, "event-source", serverConfig.EventSource, "Source of Marathon events: callback or sse")
 	flag.IntVar(&serverConfig.Port, "port", serverConfig.Port, "Listening TCP Port of the service.")
 	if serverConfig.Port == 0 {
 		serverConfig.Port = 1234 //default port when no option is provided
@@ -57,6 +71,9 @@ Example:
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replayCommand(os.Args[2:]))
+	}
 	flag.Parse()
 
 	if serverConfig.PrintVersion {
@@ -85,12 +102,296 @@ func main() {
 		}
 	}
 
+	dispatcher.ConfigureQueues(serverConfig.Queues)
+	dispatcher.ConfigureRetries(serverConfig.Retries)
+	dispatcher.ConfigureHealth(serverConfig.CriticalBackends)
+	if err := dispatcher.ConfigureRoutes(serverConfig.Routes); err != nil {
+		fmt.Printf("ERR: Invalid routes, caused by: %s\n", err)
+		os.Exit(1)
+	}
+	dispatcher.ConfigureDeduplication(time.Duration(serverConfig.DedupWindow) * time.Second)
+	if serverConfig.DeadLetterDir != "" {
+		deadLetters, err := deadletter.Open(serverConfig.DeadLetterDir)
+		if err != nil {
+			fmt.Printf("ERR: Could not open dead letters, caused by: %s\n", err)
+			os.Exit(1)
+		}
+		dispatcher.UseDeadLetters(deadLetters)
+	}
+	if serverConfig.BackendStateFile != "" {
+		if err := dispatcher.UseBackendStates(serverConfig.BackendStateFile); err != nil {
+			fmt.Printf("ERR: Could not load backend states, caused by: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if marathonSettings := serverConfig.MarathonSettings(); marathonSettings.Endpoint != "" {
+		ttl := time.Duration(marathonSettings.AppCacheTTL) * time.Second
+		if ttl <= 0 {
+			ttl = time.Minute
+		}
+		client := newMarathonClient()
+		dispatcher.UseEnrichment(client.App, ttl)
+		if err := bootstrapState(client); err != nil {
+			glog.Warningf("unable to bootstrap cluster state, building it from events only: %s", err)
+		}
+		dispatcher.UseReconciliation(func() error { return bootstrapState(client) })
+	}
+	for name, cluster := range serverConfig.Clusters {
+		if cluster.Marathon.Endpoint != "" {
+			dispatcher.UseClusterEnrichment(name, newClusterClient(cluster.Marathon).App)
+		}
+	}
+	if serverConfig.ReconcileInterval > 0 {
+		go dispatcher.ReconcileEvery(time.Duration(serverConfig.ReconcileInterval)*time.Second, nil)
+	}
+	// followers must not dispatch recovered events, so the election starts following
+	var elector *leader.Elector
+	if serverConfig.Election.Lock != "" {
+		elector = newElector(serverConfig.Election)
+	}
+	if serverConfig.JournalDir != "" {
+		eventJournal, entries, err := journal.Open(serverConfig.JournalDir, serverConfig.JournalSegment)
+		if err != nil {
+			fmt.Printf("ERR: Could not open journal, caused by: %s\n", err)
+			os.Exit(1)
+		}
+		dispatcher.UseJournal(eventJournal)
+		glog.Infof("recovering %d unfinished events from journal", len(entries))
+		dispatcher.Recover(entries)
+	}
+	stopElection := make(chan struct{})
+	electionDone := make(chan struct{})
+	if elector != nil {
+		go func() {
+			elector.Run(stopElection)
+			close(electionDone)
+		}()
+	} else {
+		close(electionDone)
+	}
+
+	var subscriptions []*marathon.Subscription
+	var streams []*marathon.EventStream
+	switch serverConfig.EventSource {
+	case "callback":
+		if serverConfig.Marathon.CallbackURL != "" {
+			subscriptions = append(subscriptions, subscribe(serverConfig.MarathonSettings()))
+		}
+		for _, cluster := range serverConfig.Clusters {
+			if cluster.Marathon.CallbackURL != "" {
+				subscriptions = append(subscriptions, subscribe(cluster.Marathon))
+			}
+		}
+		if len(subscriptions) == 0 {
+			glog.Infof("waiting for Marathon to post events")
+		}
+	case "sse":
+		streams = append(streams, streamEvents(serverConfig.MarathonSettings(), ""))
+		for name, cluster := range serverConfig.Clusters {
+			streams = append(streams, streamEvents(cluster.Marathon, name))
+		}
+	default:
+		fmt.Printf("ERR: Unknown event source '%s'\n", serverConfig.EventSource)
+		os.Exit(1)
+	}
+
 	// configure service
 	cfg := api.ServerSettings{
 		Configuration: serverConfig,
 		CertKeyPair:   keypair,
 		Httponly:      httpOnly,
 	}
-	svc := api.Service{}
-	svc.Run(cfg)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	svc := &api.Service{}
+	go func() {
+		if err := svc.Run(cfg); err != nil {
+			fmt.Printf("ERR: Could not start service, caused by: %s\n", err)
+			os.Exit(1)
+		}
+	}()
+	// the configuration is reloaded on SIGHUP, the service keeps running with the former one if it is invalid
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if err := dispatcher.ReloadConfig(); err != nil {
+				glog.Errorf("unable to reload configuration: %s", err)
+			}
+		}
+	}()
+	sig := <-signals
+	glog.Infof("received %s, shutting down", sig)
+
+	// the deadline starts first, every step below is bounded by it, so neither Marathon nor a backend
+	// can keep Howler from exiting
+	timeout := time.Duration(serverConfig.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	status := 0
+	// unsubscribe first, so Marathon stops posting to an endpoint which does not accept events anymore
+	beforeDeadline(deadline, "unregistering event subscriptions", func() {
+		var unsubscribed sync.WaitGroup
+		for _, subscription := range subscriptions {
+			unsubscribed.Add(1)
+			go func(subscription *marathon.Subscription) {
+				defer unsubscribed.Done()
+				if err := subscription.Stop(); err != nil {
+					glog.Errorf("unable to unregister event subscription: %s", err)
+				}
+			}(subscription)
+		}
+		unsubscribed.Wait()
+	})
+	for _, stream := range streams {
+		stream.Stop()
+	}
+	if unfinished := dispatcher.Drain(deadline.Sub(time.Now())); unfinished > 0 {
+		glog.Errorf("exiting with %d unfinished events", unfinished)
+		status = 1
+	}
+	// a follower takes over once the lock is released
+	close(stopElection)
+	beforeDeadline(deadline, "releasing the leader lock", func() { <-electionDone })
+	beforeDeadline(deadline, "closing the backends", dispatcher.CloseBackends)
+	if err := svc.Shutdown(deadline.Sub(time.Now())); err != nil {
+		glog.Errorf("unable to shut down the server: %s", err)
+	}
+	glog.Flush()
+	os.Exit(status)
+}
+
+//beforeDeadline runs the shutdown step and stops waiting for it once the deadline passed
+func beforeDeadline(deadline time.Time, step string, run func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run()
+	}()
+	timer := time.NewTimer(deadline.Sub(time.Now()))
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		glog.Errorf("%s did not finish before the shutdown deadline, skipping it", step)
+	}
+}
+
+//newMarathonClient creates a client of the default Marathon or exits, as Howler can not work without it
+func newMarathonClient() *marathon.Client {
+	return newClusterClient(serverConfig.MarathonSettings())
+}
+
+//newClusterClient creates a Marathon client with the settings or exits
+func newClusterClient(settings conf.Marathon) *marathon.Client {
+	client, err := marathon.NewClient(settings)
+	if err != nil {
+		fmt.Printf("ERR: Could not create Marathon client, caused by: %s\n", err)
+		os.Exit(1)
+	}
+	return client
+}
+
+//newElector creates the elector campaigning for leadership and makes this instance a follower until it wins
+func newElector(settings conf.Election) *leader.Elector {
+	var lock leader.Lock
+	switch settings.Lock {
+	case "file":
+		lock = leader.NewFileLock(settings.Path)
+	case "consul":
+		lock = leader.NewConsulLock(settings.URL, settings.Key)
+	default:
+		fmt.Printf("ERR: Unknown leader election lock '%s'\n", settings.Lock)
+		os.Exit(1)
+	}
+	ttl := time.Duration(settings.TTL) * time.Second
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	// the elector must not renew the lock or take over at a pace the session does not keep
+	if settings.Lock == "consul" && ttl < leader.MinConsulTTL {
+		glog.Warningf("Consul refuses session ttls below %s, using it instead of %s", leader.MinConsulTTL, ttl)
+		ttl = leader.MinConsulTTL
+	}
+	id := settings.ID
+	if id == "" {
+		hostname, _ := os.Hostname()
+		id = fmt.Sprintf("%s:%d", hostname, serverConfig.Port)
+	}
+	// events reach the instances at different times, the leader might accept an event up to two ttls later
+	dispatcher.Follow(2 * ttl)
+	elector := leader.NewElector(lock, id, ttl, dispatcher.SetLeader)
+	elector.ShareProgress(dispatcher.Watermark, dispatcher.Followed)
+	return elector
+}
+
+//subscribe keeps the callback URL of the settings registered as event subscriber of the Marathon
+func subscribe(settings conf.Marathon) *marathon.Subscription {
+	interval := time.Duration(settings.SubscriptionCheck) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	subscription := marathon.NewSubscription(newClusterClient(settings), settings.CallbackURL, interval)
+	go subscription.Run()
+	return subscription
+}
+
+//streamEvents consumes the event stream of the Marathon, its events are tagged with the cluster
+func streamEvents(settings conf.Marathon, cluster string) *marathon.EventStream {
+	stream := marathon.NewEventStream(newClusterClient(settings), func(payload []byte) {
+		payload, err := dispatcher.Tag(payload, cluster)
+		if err == nil {
+			err = dispatcher.Process(payload)
+		}
+		if err != nil {
+			glog.Errorf("unable to process event from stream: %s", err)
+		}
+	})
+	go stream.Run()
+	return stream
+}
+
+//bootstrapState loads the apps and tasks currently known to Marathon into the cluster state
+func bootstrapState(client *marathon.Client) error {
+	apps, err := client.Apps()
+	if err != nil {
+		return err
+	}
+	tasks, err := client.Tasks()
+	if err != nil {
+		return err
+	}
+	var stateApps []state.App
+	for _, app := range apps {
+		stateApps = append(stateApps, state.App{ID: app.ID, Version: app.Version, Instances: app.Instances, Labels: app.Labels})
+	}
+	var stateTasks []state.Task
+	for _, task := range tasks {
+		stateTask := state.Task{
+			ID:      task.ID,
+			AppID:   task.AppID,
+			SlaveID: task.SlaveID,
+			Host:    task.Host,
+			Ports:   task.Ports,
+			Status:  task.State,
+			Version: task.Version,
+		}
+		if stateTask.Status == "" {
+			// older Marathon versions only list running tasks, without their state
+			stateTask.Status = "TASK_RUNNING"
+		}
+		if len(task.HealthCheckResults) > 0 {
+			healthy := true
+			for _, result := range task.HealthCheckResults {
+				healthy = healthy && result.Alive
+			}
+			stateTask.Healthy = &healthy
+		}
+		stateTasks = append(stateTasks, stateTask)
+	}
+	state.Cluster.Bootstrap(stateApps, stateTasks)
+	glog.Infof("bootstrapped cluster state with %d apps and %d tasks", len(stateApps), len(stateTasks))
+	return nil
 }
@@ -0,0 +1,77 @@
+package marathon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/zalando-techmonkeys/howler/backend"
+)
+
+//App fetches the current definition of an app, p.e. /my-app
+func (c *Client) App(id string) (*backend.App, error) {
+	var data struct {
+		App backend.App `json:"app"`
+	}
+	if err := c.get("/v2/apps"+id, &data); err != nil {
+		return nil, err
+	}
+	return &data.App, nil
+}
+
+//Apps fetches the definitions of all apps
+func (c *Client) Apps() ([]backend.App, error) {
+	var data struct {
+		Apps []backend.App `json:"apps"`
+	}
+	if err := c.get("/v2/apps", &data); err != nil {
+		return nil, err
+	}
+	return data.Apps, nil
+}
+
+//Task is a running task as listed by /v2/tasks
+type Task struct {
+	ID                 string `json:"id"`
+	AppID              string `json:"appId"`
+	SlaveID            string `json:"slaveId"`
+	Host               string `json:"host"`
+	Ports              []int  `json:"ports"`
+	Version            string `json:"version"`
+	State              string `json:"state"`
+	HealthCheckResults []struct {
+		Alive bool `json:"alive"`
+	} `json:"healthCheckResults"`
+}
+
+//Tasks fetches all tasks of the cluster
+func (c *Client) Tasks() ([]Task, error) {
+	var data struct {
+		Tasks []Task `json:"tasks"`
+	}
+	if err := c.get("/v2/tasks", &data); err != nil {
+		return nil, err
+	}
+	return data.Tasks, nil
+}
+
+//get decodes the JSON response of a GET request against the Marathon API path
+func (c *Client) get(path string, v interface{}) error {
+	req, err := c.newRequest("GET", path)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", req.URL.Path, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("unable to decode response of GET %s: %s", req.URL.Path, err)
+	}
+	return nil
+}
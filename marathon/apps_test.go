@@ -0,0 +1,62 @@
+package marathon
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+func Test_App(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/apps/shop/cart" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"app": {"id": "/shop/cart", "labels": {"team": "checkout"}, "portDefinitions": [{"port": 10000, "protocol": "tcp"}], "version": "v2"}}`)
+	}))
+	defer server.Close()
+	client, err := NewClient(conf.Marathon{Endpoint: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := client.App("/shop/cart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Labels["team"] != "checkout" || app.Version != "v2" || len(app.PortDefinitions) != 1 || app.PortDefinitions[0].Port != 10000 {
+		fmt.Printf("Unexpected app: %+v\n", app)
+		t.FailNow()
+	}
+	if _, err := client.App("/unknown"); err == nil {
+		fmt.Println("Expected an error for an unknown app")
+		t.FailNow()
+	}
+}
+
+func Test_AppTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	client, err := NewClient(conf.Marathon{Endpoint: server.URL, RequestTimeout: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := client.App("/shop/cart"); err == nil {
+		fmt.Println("Expected a hanging Marathon to time out")
+		t.FailNow()
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		fmt.Printf("Expected the request to give up after a second, took: %s\n", elapsed)
+		t.FailNow()
+	}
+}
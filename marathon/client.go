@@ -0,0 +1,67 @@
+//Package marathon talks to the Marathon REST API on behalf of Howler.
+
+package marathon
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+//defaultRequestTimeout bounds a REST request against Marathon if no requestTimeout is configured
+const defaultRequestTimeout = 10 * time.Second
+
+//Client bundles the Marathon connection settings with configured http clients
+type Client struct {
+	config conf.Marathon
+	http   *http.Client // REST requests, bounded by the request timeout
+	stream *http.Client // the long-lived event stream, unbounded
+}
+
+//NewClient creates a Marathon client, loading the CA bundle if configured
+func NewClient(config conf.Marathon) (*Client, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("marathon endpoint is empty, please provide a valid one")
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file %s: %s", config.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	config.Endpoint = strings.TrimRight(config.Endpoint, "/")
+	timeout := time.Duration(config.RequestTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}
+	return &Client{
+		config: config,
+		http:   &http.Client{Transport: transport, Timeout: timeout},
+		stream: &http.Client{Transport: transport},
+	}, nil
+}
+
+//newRequest builds a request against the Marathon API path, authenticated if credentials are configured
+func (c *Client) newRequest(method string, path string) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.config.Endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.Username != "" && c.config.Password != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	return req, nil
+}
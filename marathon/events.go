@@ -0,0 +1,115 @@
+package marathon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+//EventStream consumes Marathon's /v2/events Server-Sent-Events stream and
+//reconnects with an exponential backoff whenever the stream breaks.
+type EventStream struct {
+	client     *Client
+	handler    func(payload []byte)
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	cancel     context.CancelFunc
+	ctx        context.Context
+}
+
+//NewEventStream creates an EventStream calling handler with the data of every received event
+func NewEventStream(client *Client, handler func(payload []byte)) *EventStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EventStream{
+		client:     client,
+		handler:    handler,
+		MinBackoff: time.Second,
+		MaxBackoff: time.Minute,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+//Run connects to the event stream and blocks until Stop is called
+func (s *EventStream) Run() {
+	backoff := s.MinBackoff
+	for {
+		connected, err := s.consume()
+		if s.ctx.Err() != nil {
+			glog.Infof("event stream stopped")
+			return
+		}
+		if connected {
+			backoff = s.MinBackoff
+		}
+		glog.Errorf("event stream interrupted: %s, reconnecting in %s", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-s.ctx.Done():
+			glog.Infof("event stream stopped")
+			return
+		}
+		backoff *= 2
+		if backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+//Stop closes the event stream
+func (s *EventStream) Stop() {
+	s.cancel()
+}
+
+//consume reads events until the connection breaks. It reports whether the stream was established.
+func (s *EventStream) consume() (bool, error) {
+	req, err := s.client.newRequest("GET", "/v2/events")
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(s.ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	res, err := s.client.stream.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected response status %s", res.Status)
+	}
+	glog.Infof("connected to event stream %s", req.URL)
+
+	var data bytes.Buffer
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) // deployment events carry whole app groups
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// an empty line terminates the event
+			if data.Len() > 0 {
+				s.handler(data.Bytes())
+				data = bytes.Buffer{}
+			}
+		case strings.HasPrefix(line, ":"):
+			// comment, used as keep alive
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		default:
+			// the event field is not needed, as the data carries the eventType itself
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, fmt.Errorf("stream closed by server")
+}
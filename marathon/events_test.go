@@ -0,0 +1,102 @@
+package marathon
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+//sseStandIn serves Marathon's /v2/events endpoint, dropping the connection after each batch of events
+func sseStandIn(batches [][]string) (*httptest.Server, func() int) {
+	var mutex sync.Mutex
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "howler" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/events" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mutex.Lock()
+		batch := connections
+		connections++
+		mutex.Unlock()
+		if batch >= len(batches) {
+			// keep the stream open until the client goes away
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep alive\n\n")
+		for _, data := range batches[batch] {
+			fmt.Fprintf(w, "event: status_update_event\ndata: %s\n\n", data)
+		}
+		w.(http.Flusher).Flush()
+	}))
+	return server, func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return connections
+	}
+}
+
+func Test_EventStream(t *testing.T) {
+	server, connections := sseStandIn([][]string{
+		{`{"eventType":"status_update_event","taskId":"1"}`, `{"eventType":"status_update_event","taskId":"2"}`},
+		{`{"eventType":"status_update_event","taskId":"3"}`},
+	})
+	defer server.Close()
+
+	client, err := NewClient(conf.Marathon{Endpoint: server.URL + "/", Username: "howler", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 10)
+	stream := NewEventStream(client, func(payload []byte) {
+		received <- string(payload)
+	})
+	stream.MinBackoff = 10 * time.Millisecond
+	go stream.Run()
+	defer stream.Stop()
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case payload := <-received:
+			expected := fmt.Sprintf(`{"eventType":"status_update_event","taskId":"%d"}`, i)
+			if payload != expected {
+				fmt.Printf("Expected: %s, got: %s\n", expected, payload)
+				t.FailNow()
+			}
+		case <-time.After(5 * time.Second):
+			fmt.Printf("Timed out waiting for event %d\n", i)
+			t.FailNow()
+		}
+	}
+	if connections() < 2 {
+		fmt.Printf("Expected a reconnect, got %d connections\n", connections())
+		t.FailNow()
+	}
+}
+
+func Test_EventStreamUnauthorized(t *testing.T) {
+	server, _ := sseStandIn(nil)
+	defer server.Close()
+
+	client, err := NewClient(conf.Marathon{Endpoint: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := NewEventStream(client, func(payload []byte) {})
+	connected, err := stream.consume()
+	if connected || err == nil {
+		fmt.Println("unauthorized stream is accepted")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,125 @@
+package marathon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+//eventSubscriptions is the response of GET /v2/eventSubscriptions
+type eventSubscriptions struct {
+	CallbackURLs []string `json:"callbackUrls"`
+}
+
+//Subscribe registers callbackURL as http callback subscriber of the Marathon event bus
+func (c *Client) Subscribe(callbackURL string) error {
+	return c.subscription("POST", callbackURL)
+}
+
+//Unsubscribe removes callbackURL from the http callback subscribers of the Marathon event bus
+func (c *Client) Unsubscribe(callbackURL string) error {
+	return c.subscription("DELETE", callbackURL)
+}
+
+func (c *Client) subscription(method string, callbackURL string) error {
+	req, err := c.newRequest(method, "/v2/eventSubscriptions?callbackUrl="+url.QueryEscape(callbackURL))
+	if err != nil {
+		return err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned %s", method, req.URL.Path, res.Status)
+	}
+	return nil
+}
+
+//Subscriptions lists all http callback subscribers of the Marathon event bus
+func (c *Client) Subscriptions() ([]string, error) {
+	req, err := c.newRequest("GET", "/v2/eventSubscriptions")
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", req.URL.Path, res.Status)
+	}
+	var subscriptions eventSubscriptions
+	if err := json.NewDecoder(res.Body).Decode(&subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions.CallbackURLs, nil
+}
+
+//Subscription keeps Howler registered as http callback subscriber,
+//so /etc/marathon/conf/http_endpoints does not have to be edited by hand.
+type Subscription struct {
+	client      *Client
+	callbackURL string
+	interval    time.Duration
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+//NewSubscription creates a Subscription verifying every interval that callbackURL is still registered
+func NewSubscription(client *Client, callbackURL string, interval time.Duration) *Subscription {
+	return &Subscription{
+		client:      client,
+		callbackURL: callbackURL,
+		interval:    interval,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+//Run registers the callback and re-registers it whenever it disappears, until Stop is called
+func (s *Subscription) Run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.ensure()
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+//ensure registers the callback URL unless Marathon already lists it
+func (s *Subscription) ensure() {
+	subscribers, err := s.client.Subscriptions()
+	if err != nil {
+		glog.Errorf("unable to list event subscriptions: %s", err)
+		return
+	}
+	for _, subscriber := range subscribers {
+		if subscriber == s.callbackURL {
+			return
+		}
+	}
+	glog.Infof("registering '%s' as event subscriber", s.callbackURL)
+	if err := s.client.Subscribe(s.callbackURL); err != nil {
+		glog.Errorf("unable to register event subscription: %s", err)
+	}
+}
+
+//Stop ends the verification loop and unsubscribes the callback URL
+func (s *Subscription) Stop() error {
+	close(s.stop)
+	<-s.done
+	glog.Infof("unregistering '%s' as event subscriber", s.callbackURL)
+	return s.client.Unsubscribe(s.callbackURL)
+}
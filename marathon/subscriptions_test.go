@@ -0,0 +1,79 @@
+package marathon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando-techmonkeys/howler/conf"
+)
+
+//subscriptionStandIn serves Marathon's /v2/eventSubscriptions endpoint
+type subscriptionStandIn struct {
+	sync.Mutex
+	callbackURLs map[string]bool
+}
+
+func (m *subscriptionStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+	switch r.Method {
+	case "GET":
+		var subscriptions eventSubscriptions
+		for callbackURL := range m.callbackURLs {
+			subscriptions.CallbackURLs = append(subscriptions.CallbackURLs, callbackURL)
+		}
+		json.NewEncoder(w).Encode(subscriptions)
+	case "POST":
+		m.callbackURLs[r.URL.Query().Get("callbackUrl")] = true
+	case "DELETE":
+		delete(m.callbackURLs, r.URL.Query().Get("callbackUrl"))
+	}
+}
+
+func (m *subscriptionStandIn) subscribed(callbackURL string) bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.callbackURLs[callbackURL]
+}
+
+func Test_Subscription(t *testing.T) {
+	callbackURL := "http://howler:12345/events?token=1"
+	standIn := &subscriptionStandIn{callbackURLs: map[string]bool{}}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	client, err := NewClient(conf.Marathon{Endpoint: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscription := NewSubscription(client, callbackURL, 10*time.Millisecond)
+	go subscription.Run()
+	waitFor := func(expected bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for standIn.subscribed(callbackURL) != expected {
+			if time.Now().After(deadline) {
+				fmt.Printf("Expected subscribed to be %t\n", expected)
+				t.FailNow()
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor(true)
+	// someone removed the subscription, it has to come back
+	client.Unsubscribe(callbackURL)
+	waitFor(true)
+
+	if err := subscription.Stop(); err != nil {
+		fmt.Printf("Unsubscribing failed: %s\n", err)
+		t.FailNow()
+	}
+	if standIn.subscribed(callbackURL) {
+		fmt.Println("Still subscribed after Stop")
+		t.FailNow()
+	}
+}
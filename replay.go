@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/zalando-techmonkeys/howler/dispatcher"
+)
+
+//replayCommand implements `howler replay`, which pushes a JSONL capture of Marathon events
+//through the backends compiled into this binary and waits until they handled all of them.
+func replayCommand(args []string) int {
+	replayFlags := flag.NewFlagSet("replay", flag.ExitOnError)
+	file := replayFlags.String("file", "", "JSONL file with one Marathon event per line")
+	backendName := replayFlags.String("backend", "", "Only replay to this backend, p.e. Baboon")
+	rate := replayFlags.Int("rate", 0, "Maximum number of events per second, 0 for no limit")
+	replayFlags.Parse(args)
+	if *file == "" {
+		fmt.Fprintf(os.Stderr, "ERR: --file is required\n")
+		replayFlags.PrintDefaults()
+		return 2
+	}
+
+	dispatcher.ConfigureQueues(serverConfig.Queues)
+	dispatcher.ConfigureRetries(serverConfig.Retries)
+	if err := dispatcher.ConfigureRoutes(serverConfig.Routes); err != nil {
+		fmt.Fprintf(os.Stderr, "ERR: Invalid routes, caused by: %s\n", err)
+		return 1
+	}
+	capture, err := os.Open(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERR: Could not open capture, caused by: %s\n", err)
+		return 1
+	}
+	defer capture.Close()
+
+	result, err := dispatcher.Replay(capture, *backendName, *rate)
+	dispatcher.Wait()
+	glog.Flush()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERR: Replay aborted, caused by: %s\n", err)
+		return 1
+	}
+	fmt.Printf("replayed %d events, %d failed\n", result.Replayed, len(result.Failed))
+	for _, failure := range result.Failed {
+		fmt.Printf("  line %d: %s\n", failure.Line, failure.Error)
+	}
+	if len(result.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,227 @@
+//Package state keeps a model of the apps, tasks and deployments of the Marathon cluster,
+//bootstrapped from the Marathon API and kept up to date from the event stream.
+
+package state
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//App is an app known to the cluster
+type App struct {
+	ID        string            `json:"id"`
+	Version   string            `json:"version"`
+	Instances int               `json:"instances"`
+	Labels    map[string]string `json:"labels"`
+}
+
+//Task is a task of an app. Healthy is nil as long as no health check result is known.
+type Task struct {
+	ID      string    `json:"id"`
+	AppID   string    `json:"appId"`
+	SlaveID string    `json:"slaveId"`
+	Host    string    `json:"host"`
+	Ports   []int     `json:"ports"`
+	Status  string    `json:"status"`
+	Version string    `json:"version"`
+	Healthy *bool     `json:"healthy"`
+	Updated time.Time `json:"updated"`
+}
+
+//Deployment is a deployment plan in progress
+type Deployment struct {
+	ID      string    `json:"id"`
+	Apps    []string  `json:"apps"`
+	Version string    `json:"version"`
+	Started time.Time `json:"started"`
+}
+
+//Snapshot is a consistent copy of the whole state
+type Snapshot struct {
+	Apps        []App        `json:"apps"`
+	Tasks       []Task       `json:"tasks"`
+	Deployments []Deployment `json:"deployments"`
+}
+
+//terminal task states, tasks reaching them are removed
+var terminal = map[string]bool{
+	"TASK_FINISHED":         true,
+	"TASK_FAILED":           true,
+	"TASK_KILLED":           true,
+	"TASK_LOST":             true,
+	"TASK_ERROR":            true,
+	"TASK_DROPPED":          true,
+	"TASK_GONE":             true,
+	"TASK_GONE_BY_OPERATOR": true,
+}
+
+//State holds the apps, tasks and deployments of the cluster
+type State struct {
+	mutex       sync.RWMutex
+	apps        map[string]App
+	tasks       map[string]Task
+	deployments map[string]Deployment
+}
+
+//Cluster is the state of the cluster Howler receives events from
+var Cluster = New()
+
+//New creates an empty state
+func New() *State {
+	return &State{
+		apps:        make(map[string]App),
+		tasks:       make(map[string]Task),
+		deployments: make(map[string]Deployment),
+	}
+}
+
+//Bootstrap replaces apps and tasks, p.e. with the ones listed by the Marathon API
+func (s *State) Bootstrap(apps []App, tasks []Task) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.apps = make(map[string]App)
+	s.tasks = make(map[string]Task)
+	for _, app := range apps {
+		s.apps[app.ID] = app
+	}
+	for _, task := range tasks {
+		s.tasks[task.ID] = task
+	}
+}
+
+//UpdateApp adds or replaces an app
+func (s *State) UpdateApp(app App) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.apps[app.ID] = app
+}
+
+//RemoveApp removes an app and all its tasks
+func (s *State) RemoveApp(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.apps, id)
+	for taskID, task := range s.tasks {
+		if task.AppID == id {
+			delete(s.tasks, taskID)
+		}
+	}
+}
+
+//UpdateTask adds or updates a task, tasks in a terminal state are removed.
+//The health of a task is kept, as status updates do not report it.
+func (s *State) UpdateTask(task Task) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if terminal[task.Status] {
+		delete(s.tasks, task.ID)
+		return
+	}
+	if known, ok := s.tasks[task.ID]; ok && task.Healthy == nil {
+		task.Healthy = known.Healthy
+	}
+	if task.Updated.IsZero() {
+		task.Updated = time.Now().UTC()
+	}
+	s.tasks[task.ID] = task
+}
+
+//SetHealth records the health check result of a task
+func (s *State) SetHealth(taskID string, healthy bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	task, ok := s.tasks[taskID]
+	if !ok {
+		return
+	}
+	task.Healthy = &healthy
+	task.Updated = time.Now().UTC()
+	s.tasks[taskID] = task
+}
+
+//StartDeployment records a deployment in progress
+func (s *State) StartDeployment(deployment Deployment) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if deployment.Started.IsZero() {
+		deployment.Started = time.Now().UTC()
+	}
+	s.deployments[deployment.ID] = deployment
+}
+
+//FinishDeployment removes a deployment which succeeded or failed
+func (s *State) FinishDeployment(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.deployments, id)
+}
+
+//App returns an app by its id
+func (s *State) App(id string) (App, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	app, ok := s.apps[id]
+	return app, ok
+}
+
+//Task returns a task by its id
+func (s *State) Task(id string) (Task, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	task, ok := s.tasks[id]
+	return task, ok
+}
+
+//Tasks returns the tasks of an app ordered by id, or all tasks if appID is empty
+func (s *State) Tasks(appID string) []Task {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	tasks := []Task{}
+	for _, task := range s.tasks {
+		if appID == "" || task.AppID == appID {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Sort(tasksByID(tasks))
+	return tasks
+}
+
+//Snapshot returns a copy of the whole state, ordered by ids
+func (s *State) Snapshot() Snapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	snapshot := Snapshot{Apps: []App{}, Tasks: []Task{}, Deployments: []Deployment{}}
+	for _, app := range s.apps {
+		snapshot.Apps = append(snapshot.Apps, app)
+	}
+	for _, task := range s.tasks {
+		snapshot.Tasks = append(snapshot.Tasks, task)
+	}
+	for _, deployment := range s.deployments {
+		snapshot.Deployments = append(snapshot.Deployments, deployment)
+	}
+	sort.Sort(appsByID(snapshot.Apps))
+	sort.Sort(tasksByID(snapshot.Tasks))
+	sort.Sort(deploymentsByID(snapshot.Deployments))
+	return snapshot
+}
+
+type appsByID []App
+
+func (a appsByID) Len() int           { return len(a) }
+func (a appsByID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a appsByID) Less(i, j int) bool { return a[i].ID < a[j].ID }
+
+type tasksByID []Task
+
+func (t tasksByID) Len() int           { return len(t) }
+func (t tasksByID) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t tasksByID) Less(i, j int) bool { return t[i].ID < t[j].ID }
+
+type deploymentsByID []Deployment
+
+func (d deploymentsByID) Len() int           { return len(d) }
+func (d deploymentsByID) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d deploymentsByID) Less(i, j int) bool { return d[i].ID < d[j].ID }
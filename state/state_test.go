@@ -0,0 +1,38 @@
+package state
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_State(t *testing.T) {
+	s := New()
+	s.Bootstrap([]App{{ID: "/my-app", Instances: 2}}, []Task{{ID: "task-1", AppID: "/my-app", Status: "TASK_RUNNING"}})
+
+	s.UpdateTask(Task{ID: "task-2", AppID: "/my-app", Host: "node1", Status: "TASK_STAGING"})
+	s.SetHealth("task-2", true)
+	s.UpdateTask(Task{ID: "task-2", AppID: "/my-app", Host: "node1", Status: "TASK_RUNNING"})
+	task, ok := s.Task("task-2")
+	if !ok || task.Status != "TASK_RUNNING" || task.Healthy == nil || !*task.Healthy {
+		fmt.Printf("Expected healthy running task-2, got: %+v\n", task)
+		t.FailNow()
+	}
+
+	s.UpdateTask(Task{ID: "task-1", AppID: "/my-app", Status: "TASK_KILLED"})
+	if tasks := s.Tasks("/my-app"); len(tasks) != 1 || tasks[0].ID != "task-2" {
+		fmt.Printf("Expected only task-2 to be left, got: %+v\n", tasks)
+		t.FailNow()
+	}
+
+	s.StartDeployment(Deployment{ID: "d1", Apps: []string{"/my-app"}})
+	if snapshot := s.Snapshot(); len(snapshot.Deployments) != 1 || len(snapshot.Apps) != 1 {
+		fmt.Printf("Unexpected snapshot: %+v\n", snapshot)
+		t.FailNow()
+	}
+	s.FinishDeployment("d1")
+	s.RemoveApp("/my-app")
+	if snapshot := s.Snapshot(); len(snapshot.Apps) != 0 || len(snapshot.Tasks) != 0 || len(snapshot.Deployments) != 0 {
+		fmt.Printf("Expected empty state, got: %+v\n", snapshot)
+		t.FailNow()
+	}
+}